@@ -1,27 +1,41 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/pnegahdar/venvy/manager"
 	"github.com/pnegahdar/venvy/modules"
+	"github.com/pnegahdar/venvy/shell"
 	"github.com/pnegahdar/venvy/util"
 	logger "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 )
 
 var activateFileEnvVar = fmt.Sprintf("%s_ACTIVATE_FILE", strings.ToUpper(venvy.ProjectName))
 var deactivateFileEnvVar = fmt.Sprintf("%s_DEACTIVATE_FILE", strings.ToUpper(venvy.ProjectName))
 var disableHistoryEnvVar = fmt.Sprintf("%s_DISABLE_CONFIG_HISTORY", strings.ToUpper(venvy.ProjectName))
+var historyMaxAgeEnvVar = fmt.Sprintf("%s_HISTORY_MAX_AGE", strings.ToUpper(venvy.ProjectName))
+var searchPathEnvVar = fmt.Sprintf("%s_PATH", strings.ToUpper(venvy.ProjectName))
+var activeProjectEnvVar = fmt.Sprintf("%s_ACTIVE_PROJECT", strings.ToUpper(venvy.ProjectName))
+var activeConfigEnvVar = fmt.Sprintf("%s_ACTIVE_CONFIG", strings.ToUpper(venvy.ProjectName))
+var activeModulesEnvVar = fmt.Sprintf("%s_ACTIVE_MODULES", strings.ToUpper(venvy.ProjectName))
+var activeStorageEnvVar = fmt.Sprintf("%s_ACTIVE_STORAGE_DIR", strings.ToUpper(venvy.ProjectName))
+var activatedAtEnvVar = fmt.Sprintf("%s_ACTIVATED_AT", strings.ToUpper(venvy.ProjectName))
+var autoActivatedEnvVar = fmt.Sprintf("%s_AUTO_ACTIVATED", strings.ToUpper(venvy.ProjectName))
+var activeStackEnvVar = fmt.Sprintf("%s_ACTIVE_STACK", strings.ToUpper(venvy.ProjectName))
+
+// First line of an activate file layered on the active projects, the shell wrapper skips deactivating them
+var stackMarker = fmt.Sprintf("# %s:stack", venvy.ProjectName)
 var evalHeleperCommand = fmt.Sprintf(`eval $(%s shell-init)`, venvy.ProjectName)
+var fishEvalHelperCommand = fmt.Sprintf(`%s shell-init fish | source`, venvy.ProjectName)
 
 var rootCmd = &cobra.Command{
 	Use:   venvy.ProjectName,
@@ -43,11 +57,13 @@ if [ "${current_cmd_type#*function}" = "$current_cmd_type" ]; then
 	function {{ .ProjectName }}(){
 		activate_f=$(mktemp);
 		deactivate_f=$(mktemp);
-		env {{ .ActivateFileEnvVar }}=${activate_f} {{ .DeactivateFileEnvVar }}=${deactivate_f} ${original_{{.ProjectName}}_cmd} $@ || return $?;
+		env {{ .ActivateFileEnvVar }}=${activate_f} {{ .DeactivateFileEnvVar }}=${deactivate_f} "${original_{{.ProjectName}}_cmd}" "$@" || return $?;
 		if [ -s ${activate_f} ]; then
-			devenv || true;
-			env {{ .ActivateFileEnvVar }}=${activate_f} {{ .DeactivateFileEnvVar }}=${deactivate_f} ${original_{{.ProjectName}}_cmd} $@ || return $?;
-			export DEACTIVATE_F=${deactivate_f};
+			if [ "$(head -n 1 ${activate_f})" != "{{ .StackMarker }}" ]; then
+				devenv --all || true;
+			fi;
+			env {{ .ActivateFileEnvVar }}=${activate_f} {{ .DeactivateFileEnvVar }}=${deactivate_f} "${original_{{.ProjectName}}_cmd}" "$@" || return $?;
+			export DEACTIVATE_F="${deactivate_f}${DEACTIVATE_F:+:${DEACTIVATE_F}}";
 			. ${activate_f} || return $?;
 		fi;
 		rm ${activate_f} > /dev/null 2>&1 || true;
@@ -55,17 +71,55 @@ if [ "${current_cmd_type#*function}" = "$current_cmd_type" ]; then
 		unset deactivate_f;
 	};
 	function devenv(){
-		if [ ! -z "${DEACTIVATE_F}" ] && [ -s "${DEACTIVATE_F}" ]; then
-			. ${DEACTIVATE_F} || return $?;
+		if [ "$1" = "--all" ]; then
+			while [ -n "${DEACTIVATE_F}" ]; do
+				devenv || return $?;
+			done;
+			return 0;
+		fi;
+		_{{ .ProjectName }}_top="${DEACTIVATE_F%%:*}";
+		if [ -n "${_{{ .ProjectName }}_top}" ] && [ -s "${_{{ .ProjectName }}_top}" ]; then
+			. "${_{{ .ProjectName }}_top}" || return $?;
+		fi;
+		rm "${_{{ .ProjectName }}_top}" >/dev/null 2>&1 || true;
+		_{{ .ProjectName }}_rest="${DEACTIVATE_F#*:}";
+		if [ "${_{{ .ProjectName }}_rest}" = "${DEACTIVATE_F}" ]; then
+			unset DEACTIVATE_F;
+		else
+			export DEACTIVATE_F="${_{{ .ProjectName }}_rest}";
+		fi;
+		unset _{{ .ProjectName }}_top _{{ .ProjectName }}_rest;
+	};
+	_{{ .ProjectName }}_auto_activate(){
+		[ "${_{{ .ProjectName }}_last_pwd}" = "${PWD}" ] && return 0;
+		_{{ .ProjectName }}_last_pwd="${PWD}";
+		_{{ .ProjectName }}_target=$("${original_{{.ProjectName}}_cmd}" __auto-resolve "${PWD}" 2>/dev/null);
+		if [ -n "${_{{ .ProjectName }}_target}" ]; then
+			if [ -z "${ {{- .ActiveProjectEnvVar -}} }" ]; then
+				{{ .ProjectName }} "${_{{ .ProjectName }}_target}" --auto;
+			elif [ -n "${ {{- .AutoActivatedEnvVar -}} }" ] && [ "${_{{ .ProjectName }}_target}" != "${ {{- .AutoActivatedEnvVar -}} }" ]; then
+				devenv && {{ .ProjectName }} "${_{{ .ProjectName }}_target}" --auto;
+			fi;
+		elif [ -n "${ {{- .AutoActivatedEnvVar -}} }" ]; then
+			devenv;
 		fi;
-		rm ${DEACTIVATE_F} >/dev/null 2>&1 || true;
-		unset DEACTIVATE_F;
+		unset _{{ .ProjectName }}_target;
 	};
+	if [ -n "$ZSH_VERSION" ]; then
+		autoload -Uz add-zsh-hook && add-zsh-hook chpwd _{{ .ProjectName }}_auto_activate;
+		_{{ .ProjectName }}_auto_activate;
+	elif [ -n "$BASH_VERSION" ]; then
+		PROMPT_COMMAND="_{{ .ProjectName }}_auto_activate;${PROMPT_COMMAND}";
+	fi;
 fi;
 `
 
 var defaultJumpModule = &venvy.Module{Name: "jump_builtin", Type: "jump"}
-var defaultPS1Module = &venvy.Module{Name: "ps1_builtin", Type: "ps1"}
+
+// The builtin prompt styled by the ps1 settings of the user config
+func defaultPS1Module() *venvy.Module {
+	return &venvy.Module{Name: "ps1_builtin", Type: "ps1", Config: userConfig().PS1, SourcePath: userConfig().SourcePath}
+}
 
 func evalScript() (string, error) {
 	originalCmd := os.Args[0]
@@ -73,71 +127,214 @@ func evalScript() (string, error) {
 		ProjectName          string
 		ActivateFileEnvVar   string
 		DeactivateFileEnvVar string
+		ActiveProjectEnvVar  string
+		AutoActivatedEnvVar  string
 		OriginalCmd          string
+		StackMarker          string
 	}{
 		ProjectName:          venvy.ProjectName,
 		ActivateFileEnvVar:   activateFileEnvVar,
 		DeactivateFileEnvVar: deactivateFileEnvVar,
+		ActiveProjectEnvVar:  activeProjectEnvVar,
+		AutoActivatedEnvVar:  autoActivatedEnvVar,
 		OriginalCmd:          originalCmd,
+		StackMarker:          stackMarker,
 	})
 }
 
-func issueExec(manager *venvy.ProjectManager, cmd string) {
-	// Add exec module
-	execConfig, err := json.Marshal(&modules.ExecConfig{ActivationCommands: []string{cmd}})
-	errExit(err)
-	execModule := &venvy.Module{Name: "exec_subcommand", Type: "exec", Config: json.RawMessage(execConfig)}
-	manager.AppendModules(execModule)
+// Part of an activation or deactivation script with what produced it
+type scriptBlock struct {
+	Label  string
+	Script *shell.Script
+}
 
-	// Setup activation scripts`
-	activationScript, err := manager.ShellActivateCommands()
-	errExit(err)
-	deactivationScript, err := manager.ShellDeactivateCommands()
-	errExit(err)
-	scriptBody := strings.Join([]string{
-		"set -e",
-		strings.Join(activationScript, "\n"),
-		strings.Join(deactivationScript, "\n"),
-	}, "\n")
+// Per module blocks of the project scripts in the order they run, the metadata is set last and cleared first
+func projectBlocks(manager *venvy.ProjectManager, metadata *shell.Script) (activate []*scriptBlock, deactivate []*scriptBlock, err error) {
+	moduleScripts, err := manager.ModuleScripts()
+	if err != nil {
+		return nil, nil, err
+	}
+	if metadata != nil {
+		deactivate = append(deactivate, &scriptBlock{Label: "venvy metadata", Script: metadata.Undo(os.LookupEnv)})
+	}
+	for i, moduleScript := range moduleScripts {
+		activate = append(activate, &scriptBlock{Label: fmt.Sprintf("module %s (%s)", moduleScript.Name, moduleScript.Type), Script: moduleScript.Activate})
+		last := moduleScripts[len(moduleScripts)-1-i]
+		deactivate = append(deactivate, &scriptBlock{Label: fmt.Sprintf("module %s (%s)", last.Name, last.Type), Script: last.Deactivate})
+	}
+	if metadata != nil {
+		activate = append(activate, &scriptBlock{Label: "venvy metadata", Script: metadata})
+	}
+	return activate, deactivate, nil
+}
 
-	// Write activation script
+func joinBlocks(blocks []*scriptBlock) *shell.Script {
+	joined := shell.New()
+	for _, block := range blocks {
+		joined.Extend(block.Script)
+	}
+	return joined
+}
+
+// Prints the scripts block by block with comments naming what produced each, nothing is run or written
+func printDryRun(shellName string, preamble []string, activate []*scriptBlock, deactivate []*scriptBlock) {
+	fmt.Printf("# %s dry run rendered for %s\n", venvy.ProjectName, shellName)
+	for _, line := range preamble {
+		fmt.Println(line)
+	}
+	for _, section := range []struct {
+		name   string
+		blocks []*scriptBlock
+	}{{"activation", activate}, {"deactivation", deactivate}} {
+		fmt.Printf("\n# %s\n", section.name)
+		for _, block := range section.blocks {
+			fmt.Printf("# %s\n%s\n", block.Label, shell.Render(shellName, block.Script))
+		}
+	}
+}
+
+// Exec scripts activate, run the command and deactivate in one go, the command runs after every module
+func execBlocks(manager *venvy.ProjectManager, argv []string) (activate []*scriptBlock, deactivate []*scriptBlock, err error) {
+	activate, deactivate, err = projectBlocks(manager, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// A signal during activation stops the command from starting, exiting the way sh does when a command is killed
+	command := shell.New().
+		RunRaw(fmt.Sprintf(`[ -z "${_%s_signal-}" ] || exit "$_%s_signal"`, venvy.ProjectName, venvy.ProjectName)).
+		Run(argv...)
+	activate = append(activate, &scriptBlock{Label: "command", Script: command})
+	return activate, deactivate, nil
+}
+
+// Exit statuses sh reports for commands killed by the signals exec scripts trap
+var execTrapSignals = []struct {
+	name   string
+	status int
+}{{"HUP", 129}, {"INT", 130}, {"QUIT", 131}, {"TERM", 143}}
+
+// Traps making the exec script deactivate on any exit. A trapped signal is only recorded, the script keeps waiting
+// for the command and exits with its real status, which sh reports as 128+n only if the command died from the signal.
+func execTraps() []string {
+	traps := []string{fmt.Sprintf("trap _%s_exec_exit EXIT", venvy.ProjectName)}
+	for _, trapSignal := range execTrapSignals {
+		traps = append(traps, fmt.Sprintf("trap '_%s_signal=%d' %s", venvy.ProjectName, trapSignal.status, trapSignal.name))
+	}
+	return traps
+}
+
+// The script activates, runs the command and always deactivates, exiting with the status of the first failure
+func execScript(activate []*scriptBlock, deactivate []*scriptBlock) string {
+	exitHook := fmt.Sprintf("_%s_exec_exit() {\n_%s_status=$?\ntrap - EXIT HUP INT QUIT TERM\n{ %s\n}\nexit $_%s_status\n}",
+		venvy.ProjectName, venvy.ProjectName, shell.Render(shell.Posix, joinBlocks(deactivate)), venvy.ProjectName)
+	lines := append([]string{exitHook}, execTraps()...)
+	lines = append(lines, fmt.Sprintf("{ %s\n} || exit", shell.Render(shell.Posix, joinBlocks(activate))))
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Writes the exec script of the project to a temp file, the caller removes it
+func writeExecScript(manager *venvy.ProjectManager, argv []string) (string, error) {
+	activate, deactivate, err := execBlocks(manager, argv)
+	if err != nil {
+		return "", err
+	}
 	f, err := ioutil.TempFile("", "eval")
-	errExit(err)
-	f.Write([]byte(scriptBody))
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write([]byte(execScript(activate, deactivate)))
 	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
 	logger.Debugf("wrote exec file to %s", f.Name())
+	return f.Name(), nil
+}
+
+// Runs argv in the activated environment, every arg is quoted so it reaches the command unchanged
+func issueExec(manager *venvy.ProjectManager, argv []string) {
+	if dryRun {
+		activate, deactivate, err := execBlocks(manager, argv)
+		errExit(err)
+		preamble := append(execTraps(), fmt.Sprintf("# _%s_exec_exit runs the deactivation and exits with the status of the activation", venvy.ProjectName))
+		printDryRun(shell.Posix, preamble, activate, deactivate)
+		return
+	}
+
+	// Write activation script
+	scriptPath, err := writeExecScript(manager, argv)
+	errExit(err)
+	defer os.Remove(scriptPath)
 
 	// Execute command
-	cmdArgs := []string{"sh", f.Name()}
-	baseContext, cancelFunc := context.WithCancel(context.Background())
-	defer cancelFunc()
-	execCmd := exec.CommandContext(baseContext, "/usr/bin/env", cmdArgs...)
+	execCmd := exec.Command("sh", scriptPath)
 	execCmd.Stderr = os.Stderr
 	execCmd.Stdout = os.Stdout
 	execCmd.Stdin = os.Stdin
+	restoreTerminal := setupExecGroup(execCmd)
+	signalC := make(chan os.Signal, 1)
+	signal.Notify(signalC, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	err = execCmd.Start()
+	if err != nil {
+		signal.Stop(signalC)
+		restoreTerminal()
+		errExit(err)
+	}
+	done := make(chan struct{})
 	go func() {
-		signalC := make(chan os.Signal, 1)
-		signal.Notify(signalC, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-		select {
-		case c := <-signalC:
-			logger.Warnf("Got signal %s", c.String())
-			cancelFunc()
-		case <-baseContext.Done():
-			return
+		for {
+			select {
+			case c := <-signalC:
+				logger.Debugf("Forwarding signal %s", c.String())
+				forwardSignal(execCmd, c)
+			case <-done:
+				return
+			}
 		}
 	}()
-	err = execCmd.Run()
+	err = execCmd.Wait()
+	close(done)
+	restoreTerminal()
+	os.Remove(scriptPath)
+	if _, ok := err.(*exec.ExitError); ok {
+		exitLike(execCmd.ProcessState)
+	}
 	errExit(err)
 }
 
-func issueActivate(manager *venvy.ProjectManager, activatePath string, deactivatePath string) {
+// Records what is active in the shell so `venvy status` and other tooling can query it
+func activationMetadata(manager *venvy.ProjectManager) *shell.Script {
+	metadata := shell.New().
+		Set(activeProjectEnvVar, commandName(manager)).
+		Set(activeConfigEnvVar, manager.ConfigManager().ConfigPath()).
+		Set(activeModulesEnvVar, strings.Join(manager.Project.Modules, ",")).
+		Set(activeStorageEnvVar, manager.StoragePath()).
+		Set(activatedAtEnvVar, time.Now().UTC().Format(time.RFC3339))
+	// Names the top layer when the hook activated it, which the hook then replaces or pops leaving layers below alone
+	if autoActivation {
+		metadata.Set(autoActivatedEnvVar, qualifiedCommandName(manager))
+	} else {
+		metadata.Unset(autoActivatedEnvVar)
+	}
+	metadata.Set(activeStackEnvVar, strings.Join(activeStack(manager), ","))
+	return metadata
+}
+
+func issueActivate(manager *venvy.ProjectManager, shellName string, activatePath string, deactivatePath string) {
 	// prep activation scripts
-	activationLines, err := manager.ShellActivateCommands()
-	errExit(err)
-	activationScript := []byte(strings.Join(activationLines, " && \\\n"))
-	deactivationLines, err := manager.ShellDeactivateCommands()
+	activate, deactivate, err := projectBlocks(manager, activationMetadata(manager))
 	errExit(err)
-	deactivationScript := []byte(strings.Join(deactivationLines, " && \\\n"))
+	preamble := []string{}
+	if stackActivation {
+		preamble = append(preamble, stackMarker)
+	}
+	if dryRun {
+		printDryRun(shellName, preamble, activate, deactivate)
+		return
+	}
+	activationScript := []byte(strings.Join(append(preamble, shell.Render(shellName, joinBlocks(activate))), "\n"))
+	deactivationScript := []byte(shell.Render(shellName, joinBlocks(deactivate)))
 
 	// write activation scripts
 	err = ioutil.WriteFile(activatePath, activationScript, 0600)
@@ -149,21 +346,66 @@ func issueActivate(manager *venvy.ProjectManager, activatePath string, deactivat
 }
 
 func preSubCommand(cmd *cobra.Command, manager *venvy.ProjectManager) {
+	var err error
+	dryRun, err = cmd.Flags().GetBool("dry-run")
+	errExit(err)
 	reset, err := cmd.Flags().GetBool("reset")
 	errExit(err)
+	temp, err := cmd.Flags().GetBool("temp")
+	errExit(err)
+	if dryRun {
+		if reset || temp {
+			logger.Warnf("--reset and --temp are skipped in a dry run")
+		}
+		return
+	}
+
 	if reset {
 		err := manager.Reset()
 		errExit(err)
 	}
 
-	temp, err := cmd.Flags().GetBool("temp")
-	errExit(err)
 	if temp {
-		name, err := ioutil.TempDir("", venvy.ProjectName)
-		errExit(err)
-		err = manager.ChDir(name)
-		errExit(err)
-		logger.Debugf("Using temp dir for venv %s", name)
+		errExit(useTempDir(manager))
+	}
+}
+
+func useTempDir(manager *venvy.ProjectManager) error {
+	name, err := ioutil.TempDir("", venvy.ProjectName)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("Using temp dir for venv %s", name)
+	return manager.ChDir(name)
+}
+
+// Set by --auto, the directory change hook activates without jumping into the project root
+var autoActivation = false
+
+// Set by --dry-run, scripts are printed instead of written or run
+var dryRun = false
+
+// Set by --stack, the activation is layered on top of the active projects
+var stackActivation = false
+
+// Active projects oldest first, ending with the one being activated
+func activeStack(manager *venvy.ProjectManager) []string {
+	stack := []string{}
+	if current := os.Getenv(activeStackEnvVar); stackActivation && current != "" {
+		stack = strings.Split(current, ",")
+	}
+	return append(stack, commandName(manager))
+}
+
+// Adds the builtin ps1 and jump modules, calling it again for the same project adds nothing
+func addBuiltinModules(manager *venvy.ProjectManager) {
+	if manager.Project.DisableBuiltinModules {
+		return
+	}
+	if autoActivation {
+		manager.PrependModules(defaultPS1Module())
+	} else {
+		manager.PrependModules(defaultPS1Module(), defaultJumpModule)
 	}
 }
 
@@ -175,27 +417,86 @@ func makeActivationCommand(manager *venvy.ProjectManager) func(cmd *cobra.Comman
 			fmt.Println(manager.RootDir())
 			os.Exit(0)
 		}
+		autoActivation, err = cmd.Flags().GetBool("auto")
+		errExit(err)
+		stackActivation, err = cmd.Flags().GetBool("stack")
+		errExit(err)
+		subshell, err := cmd.Flags().GetBool("shell")
+		errExit(err)
+		// The hook pops the layer it replaces itself
+		stackActivation = stackActivation || subshell || autoActivation
+		if stackActivation {
+			for _, active := range strings.Split(os.Getenv(activeStackEnvVar), ",") {
+				if active == commandName(manager) {
+					errExit(fmt.Errorf("project %s is already active", active))
+				}
+			}
+		}
+		export, err := cmd.Flags().GetString("export")
+		errExit(err)
 		preSubCommand(cmd, manager)
-		if !manager.Project.DisableBuiltinModules {
-			manager.PrependModules(defaultPS1Module, defaultJumpModule)
+		if export != "" {
+			issueExport(manager, export)
+			return
 		}
-		if len(args) == 0 {
+		addBuiltinModules(manager)
+		if subshell {
+			// Args are passed to the shell
+			issueSubshell(manager, args)
+		} else if len(args) == 0 {
 			// Activation
 			activatePath, deactivatePath, bothSet := EvalPaths()
-			if bothSet {
-				issueActivate(manager, activatePath, deactivatePath)
+			if bothSet || dryRun {
+				issueActivate(manager, invokingShell(), activatePath, deactivatePath)
 			} else {
-				err := fmt.Errorf("please add `%s` to your .bashrc/.zshrc to enable shell support", evalHeleperCommand)
+				err := fmt.Errorf("please add `%s` to your .bashrc/.zshrc (or `%s` to your config.fish) to enable shell support", evalHeleperCommand, fishEvalHelperCommand)
 				errExit(err)
 			}
 		} else {
-			issueExec(manager, strings.Join(args, " "))
+			issueExec(manager, args)
+		}
+	}
+}
+
+// Our own flags before the script args are parsed, everything from the first other arg on is passed to the script as is
+func parseLeadingFlags(cmd *cobra.Command, args []string) ([]string, error) {
+	cmd.DisableFlagParsing = false
+	defer func() { cmd.DisableFlagParsing = true }()
+	// Merges the root flags so they can be looked up
+	err := cmd.ParseFlags(nil)
+	if err != nil {
+		return nil, err
+	}
+	ours := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			return args[i+1:], cmd.ParseFlags(ours)
+		}
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		var flag *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			flag = cmd.Flags().Lookup(name)
+		} else if strings.HasPrefix(arg, "-") && len(name) == 1 {
+			flag = cmd.Flags().ShorthandLookup(name)
 		}
+		if flag == nil {
+			return args[i:], cmd.ParseFlags(ours)
+		}
+		ours = append(ours, arg)
 	}
+	return nil, cmd.ParseFlags(ours)
 }
 
 func makeScriptCommand(manager *venvy.ProjectManager, script *foundScript) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
+		args, err := parseLeadingFlags(cmd, args)
+		errExit(err)
+		showHelp, err := cmd.Flags().GetBool("help")
+		errExit(err)
+		if showHelp {
+			cmd.Help()
+			return
+		}
 		showPath, err := cmd.Flags().GetBool("print-path")
 		errExit(err)
 		if showPath {
@@ -203,14 +504,8 @@ func makeScriptCommand(manager *venvy.ProjectManager, script *foundScript) func(
 			os.Exit(0)
 		}
 		preSubCommand(cmd, manager)
-		toExec := script.FilePath
-		if script.ExecPrefix != " " {
-			toExec = script.ExecPrefix + " " + toExec
-		}
-		if len(args) > 0 {
-			toExec += " " + strings.Join(args, " ")
-		}
-		issueExec(manager, toExec)
+		argv := append(strings.Fields(script.ExecPrefix), script.FilePath)
+		issueExec(manager, append(argv, args...))
 	}
 }
 
@@ -220,67 +515,188 @@ func isCIEnv() bool {
 	return isCI || isJenkins
 }
 
-func LoadConfigCommands() ([]*cobra.Command, error) {
-	cmds := []*cobra.Command{}
+func useConfigHistory() bool {
 	useHistory := true
 	if isCIEnv() {
 		logger.Debug("Not using config history, CI environment detected.")
 	}
+	if history := userConfig().History; history != nil && !*history {
+		logger.Debugf("Not using config history because it's off in the user config")
+		useHistory = false
+	}
 	if os.Getenv(disableHistoryEnvVar) != "" {
 		logger.Debugf("Not using config history because envar %s is set", disableHistoryEnvVar)
 		useHistory = false
 	}
-	foundConfigs := LoadConfigs(true, useHistory)
-	seenProjects := map[string]string{}
+	return useHistory
+}
+
+// Every project that got a command, in precedence order
+var loadedProjects []*venvy.ProjectManager
+
+// The command activating a loaded project, qualified when another project has its bare name
+type projectCommand struct {
+	Name      string
+	Qualified string
+}
+
+var projectCommands = map[*venvy.ProjectManager]*projectCommand{}
+
+// Recorded as the active project so it can be activated again by that name
+func commandName(manager *venvy.ProjectManager) string {
+	if command, ok := projectCommands[manager]; ok {
+		return command.Name
+	}
+	return manager.Project.Name
+}
+
+// The namespace:project name of a loaded project, stays the same from any cwd
+func qualifiedCommandName(manager *venvy.ProjectManager) string {
+	if command, ok := projectCommands[manager]; ok {
+		return command.Qualified
+	}
+	return manager.Project.Name
+}
+
+type loadedConfig struct {
+	found   *foundConfig
+	manager *venvy.ConfigManager
+}
+
+// Config managers for every loadable config, linked so projects can extend across configs
+func loadConfigManagers(foundConfigs []*foundConfig) ([]*loadedConfig, error) {
+	loaded := []*loadedConfig{}
+	managers := []*venvy.ConfigManager{}
 	for _, configF := range foundConfigs {
 		config := configF.Config()
 		if config == nil {
 			continue
 		}
 		configManager, err := venvy.NewConfigManager(config, configF.Path, configF.StorageDir, modules.DefaultModuleMakers)
-		errExit(err)
-		for _, project := range config.Projects {
-			existingPath, ok := seenProjects[project.Name]
+		if err != nil {
+			return nil, err
+		}
+		configManager.SetUserConfig(userConfig())
+		loaded = append(loaded, &loadedConfig{found: configF, manager: configManager})
+		managers = append(managers, configManager)
+	}
+	venvy.LinkConfigManagers(managers...)
+	return loaded, nil
+}
+
+func LoadConfigCommands() ([]*cobra.Command, error) {
+	cmds := []*cobra.Command{}
+	cachedProjects := []*cachedProject{}
+	loadedConfigs, err := loadConfigManagers(LoadConfigs(true, useConfigHistory()))
+	if err != nil {
+		return nil, err
+	}
+	// Configs come nearest to the cwd first, so its projects get the bare names. Every project is also available
+	// as namespace:project.
+	seenProjects := map[string]string{}
+	for _, loaded := range loadedConfigs {
+		configF, configManager := loaded.found, loaded.manager
+		namespace := configNamespace(configF)
+		for _, project := range configF.Config().Projects {
+			qualified := qualifiedName(namespace, project.Name)
+			existingPath, ok := seenProjects[qualified]
 			if ok {
-				logger.Warnf("Project %s already exists in file %s, skipping the one from file %s. Please resolve conflict.", project.Name, existingPath, configF.Path)
+				logger.Warnf("Project %s already exists in file %s, skipping the one from file %s. Please set a different namespace in one of them.", qualified, existingPath, configF.Path)
 				continue
 			}
-			seenProjects[project.Name] = configF.Path
+			seenProjects[qualified] = configF.Path
+			name := project.Name
+			if existingPath, ok := seenProjects[project.Name]; ok {
+				logger.Debugf("Project %s from file %s is shadowed by the one from file %s, it is available as %s", project.Name, configF.Path, existingPath, qualified)
+				name = qualified
+			} else {
+				seenProjects[project.Name] = configF.Path
+			}
 			projectManager, err := configManager.ProjectManager(project.Name)
-			errExit(err)
-			activateCommand := &cobra.Command{
-				Use:   project.Name,
-				Short: fmt.Sprintf("Activate environment %s", project.Name),
-				Run:   makeActivationCommand(projectManager),
+			if err != nil {
+				logger.Warnf("skipping project %s, run `%s validate` for details: %s", qualified, venvy.ProjectName, err)
+				continue
 			}
-			activateCommand.Flags().Bool("reset", false, fmt.Sprintf("reset the environment data before initalizing"))
-			activateCommand.Flags().Bool("temp", false, fmt.Sprintf("create a temp data dir for the session"))
-			activateCommand.Flags().Bool("print-root", false, fmt.Sprintf("print the root dir of the project"))
-
+			loadedProjects = append(loadedProjects, projectManager)
+			projectCommands[projectManager] = &projectCommand{Name: name, Qualified: qualified}
+			activateCommand := newActivateCommand(name, qualified)
+			activateCommand.Run = makeActivationCommand(projectManager)
 			cmds = append(cmds, activateCommand)
-			for _, script := range configF.Scripts()[project.Name] {
-				subCommand := &cobra.Command{
-					Use:   fmt.Sprintf("%s.%s", project.Name, script.SubCommand),
-					Short: script.Docstring,
-					Run:   makeScriptCommand(projectManager, script),
-				}
-				subCommand.Flags().Bool("reset", false, fmt.Sprintf("reset the environment data before initalizing"))
-				subCommand.Flags().Bool("temp", false, fmt.Sprintf("create a temp data dir for the session"))
-				subCommand.Flags().Bool("print-path", false, fmt.Sprintf("print the path of the script"))
+			scripts := configF.Scripts(projectManager.Project)
+			for _, script := range scripts {
+				subCommand := newScriptCommand(name, qualified, script)
+				subCommand.Run = makeScriptCommand(projectManager, script)
 				cmds = append(cmds, subCommand)
-
 			}
+			cachedProjects = append(cachedProjects, &cachedProject{Name: name, Qualified: qualified, Scripts: scripts})
 		}
 	}
+	writeCompletionCache(cachedProjects)
 	return cmds, nil
 
 }
 
+// Commands are also built from the completion cache, without a Run. The qualified name is an alias unless it's
+// the command's name.
+func newActivateCommand(projectName string, qualified string) *cobra.Command {
+	activateCommand := &cobra.Command{
+		Use:         projectName,
+		Short:       fmt.Sprintf("Activate environment %s", projectName),
+		Annotations: map[string]string{projectAnnotation: projectName},
+	}
+	if qualified != "" && qualified != projectName {
+		activateCommand.Aliases = []string{qualified}
+	}
+	activateCommand.Flags().Bool("reset", false, fmt.Sprintf("reset the environment data before initalizing"))
+	activateCommand.Flags().Bool("temp", false, fmt.Sprintf("create a temp data dir for the session"))
+	activateCommand.Flags().Bool("print-root", false, fmt.Sprintf("print the root dir of the project"))
+	activateCommand.Flags().Bool("dry-run", false, fmt.Sprintf("print the activation and deactivation scripts without making any changes"))
+	activateCommand.Flags().Bool("shell", false, fmt.Sprintf("start an interactive $SHELL with the environment activated, args after -- are passed to the shell"))
+	activateCommand.Flags().String("export", "", fmt.Sprintf("print the variables the activation sets as %s", strings.Join(exportFormats, ", ")))
+	activateCommand.Flags().Bool("stack", false, fmt.Sprintf("layer the activation on top of the active projects instead of replacing them"))
+	activateCommand.Flags().Bool("auto", false, fmt.Sprintf("activation triggered by the directory change hook"))
+	activateCommand.Flags().MarkHidden("auto")
+
+	// Everything from the first arg on is the command to run, flags included
+	activateCommand.Flags().SetInterspersed(false)
+	return activateCommand
+}
+
+func newScriptCommand(projectName string, qualified string, script *foundScript) *cobra.Command {
+	subCommand := &cobra.Command{
+		Use:   fmt.Sprintf("%s.%s", projectName, script.SubCommand),
+		Short: script.Docstring,
+		// Flags meant for the script are passed through, ours are parsed by the command
+		DisableFlagParsing: true,
+	}
+	if qualified != "" && qualified != projectName {
+		subCommand.Aliases = []string{fmt.Sprintf("%s.%s", qualified, script.SubCommand)}
+	}
+	subCommand.Flags().Bool("reset", false, fmt.Sprintf("reset the environment data before initalizing"))
+	subCommand.Flags().Bool("temp", false, fmt.Sprintf("create a temp data dir for the session"))
+	subCommand.Flags().Bool("dry-run", false, fmt.Sprintf("print the script that would run without making any changes"))
+	subCommand.Flags().Bool("print-path", false, fmt.Sprintf("print the path of the script"))
+	return subCommand
+}
+
 var evalCmd = &cobra.Command{
-	Use:   "shell-init",
-	Short: "Shell helper",
+	Use:       "shell-init [bash|zsh|sh|fish]",
+	Short:     "Shell helper",
+	ValidArgs: knownShells,
+	Args:      cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		evalScript, err := evalScript()
+		shellName := detectShell()
+		if len(args) == 1 {
+			shellName = shellFromName(args[0])
+			if shellName == "" {
+				errExit(fmt.Errorf("unsupported shell %s, expected one of %s", args[0], strings.Join(knownShells, ", ")))
+			}
+		}
+		script := evalScript
+		if shellName == shell.Fish {
+			script = fishEvalScript
+		}
+		evalScript, err := script()
 		errExit(err)
 		fmt.Println(evalScript)
 	},
@@ -318,6 +734,13 @@ func main() {
 	}
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(evalCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(autoResolveCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(completeCmd)
 	cobra.OnInitialize(handleCliInit)
 
 	// Set debug early on so
@@ -329,8 +752,20 @@ func main() {
 			break
 		}
 	}
-	configCmds, err := LoadConfigCommands()
-	if err != nil {
+	// Completion runs on every TAB, it gets the project commands from the cache instead of discovering configs.
+	// History commands need no projects, discovery would record and prune the history they're about to show. The
+	// directory change hook resolves on every cd from configs it loads without writing anything.
+	var configCmds []*cobra.Command
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case completeCmd.Name():
+		configCmds = cachedCommands()
+	case historyCmd.Name(), autoResolveCmd.Name():
+	default:
+		configCmds, err = LoadConfigCommands()
 		errExit(err)
 	}
 
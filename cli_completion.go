@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/pnegahdar/venvy/util"
+	logger "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Marks the activation command of a project
+const projectAnnotation = "venvy_project"
+
+var completionCachePath = globalPath("completion_cache.json")
+
+// Directories the completion cache holds commands for, the least recently updated are dropped first
+const maxCompletionDirs = 100
+
+type cachedProject struct {
+	Name      string         `json:"name"`
+	Qualified string         `json:"qualified"`
+	Scripts   []*foundScript `json:"scripts"`
+}
+
+// The project and script commands of the last run in a directory
+type cachedDir struct {
+	Projects  []*cachedProject `json:"projects"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// Read by completion so it doesn't have to discover configs. Keyed by the cwd as the configs found and which
+// project gets a bare name depend on it.
+type completionCache struct {
+	Dirs map[string]*cachedDir `json:"dirs"`
+}
+
+func loadCompletionCache() (*completionCache, error) {
+	cache := &completionCache{}
+	data, err := ioutil.ReadFile(completionCachePath)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, cache)
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// Records the commands of the cwd, failures only cost completion speed so they're logged and ignored
+func writeCompletionCache(projects []*cachedProject) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		logger.Debugf("unable to get the cwd for the completion cache with err %s", err)
+		return
+	}
+	cache, err := loadCompletionCache()
+	if err != nil || cache.Dirs == nil {
+		cache = &completionCache{Dirs: map[string]*cachedDir{}}
+	}
+	cache.Dirs[cwd] = &cachedDir{Projects: projects, UpdatedAt: time.Now()}
+	for len(cache.Dirs) > maxCompletionDirs {
+		oldest := ""
+		for dir, cached := range cache.Dirs {
+			if oldest == "" || cached.UpdatedAt.Before(cache.Dirs[oldest].UpdatedAt) {
+				oldest = dir
+			}
+		}
+		delete(cache.Dirs, oldest)
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		logger.Debugf("unable to marshal completion cache with err %s", err)
+		return
+	}
+	os.MkdirAll(filepath.Dir(completionCachePath), 0700)
+	err = ioutil.WriteFile(completionCachePath, data, 0600)
+	if err != nil {
+		logger.Debugf("unable to save completion cache to %s with err %s", completionCachePath, err)
+	}
+}
+
+// Project commands without a Run built from the cache, configs are discovered once in a directory without a cache
+func cachedCommands() []*cobra.Command {
+	var cached *cachedDir
+	cwd, err := os.Getwd()
+	if err == nil {
+		var cache *completionCache
+		cache, err = loadCompletionCache()
+		if err == nil {
+			cached = cache.Dirs[cwd]
+		}
+	}
+	if cached == nil {
+		logger.Debugf("no usable completion cache for the cwd, discovering configs: %v", err)
+		cmds, err := LoadConfigCommands()
+		errExit(err)
+		return cmds
+	}
+	cmds := []*cobra.Command{}
+	for _, project := range cached.Projects {
+		cmds = append(cmds, newActivateCommand(project.Name, project.Qualified))
+		for _, script := range project.Scripts {
+			cmds = append(cmds, newScriptCommand(project.Name, project.Qualified, script))
+		}
+	}
+	return cmds
+}
+
+// Whether qualified namespace:project names are completed, only once one is being typed so lists stay short
+func completesQualified(partial string) bool {
+	return strings.Contains(partial, namespaceSeparator)
+}
+
+func projectNames(partial string) []string {
+	names := []string{}
+	for _, cmd := range rootCmd.Commands() {
+		if name, ok := cmd.Annotations[projectAnnotation]; ok {
+			names = append(names, name)
+			if completesQualified(partial) {
+				names = append(names, cmd.Aliases...)
+			}
+		}
+	}
+	return names
+}
+
+// Values completed for flags taking one, by flag name
+var flagValueCompletions = map[string]func(partial string) []string{
+	"export":  func(partial string) []string { return exportFormats },
+	"project": projectNames,
+}
+
+func lookupFlag(cmd *cobra.Command, word string) *pflag.Flag {
+	name := strings.SplitN(strings.TrimLeft(word, "-"), "=", 2)[0]
+	if strings.HasPrefix(word, "--") {
+		return cmd.Flags().Lookup(name)
+	}
+	if len(name) == 1 {
+		return cmd.Flags().ShorthandLookup(name)
+	}
+	return nil
+}
+
+func findSubcommand(cmd *cobra.Command, name string) *cobra.Command {
+	for _, sub := range cmd.Commands() {
+		if sub.Name() == name || sub.HasAlias(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// Candidates for the last of words, each as "value\tdescription"
+func completions(root *cobra.Command, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	partial := words[len(words)-1]
+	cmd := root
+	var expectsValue *pflag.Flag
+	for _, word := range words[:len(words)-1] {
+		switch {
+		case expectsValue != nil:
+			expectsValue = nil
+		case word == "--":
+			// What follows is a command line of its own
+			return nil
+		case strings.HasPrefix(word, "-"):
+			if flag := lookupFlag(cmd, word); flag != nil && flag.Value.Type() != "bool" && !strings.Contains(word, "=") {
+				expectsValue = flag
+			}
+		default:
+			sub := findSubcommand(cmd, word)
+			if sub == nil {
+				// Positional args are commands to run or take a single value
+				return nil
+			}
+			cmd = sub
+			// Registers the inherited flags with the command so lookups find them
+			cmd.InheritedFlags()
+		}
+	}
+
+	candidates := []string{}
+	add := func(value string, description string) {
+		if strings.HasPrefix(value, partial) {
+			candidates = append(candidates, value+"\t"+description)
+		}
+	}
+	addValues := func(flag *pflag.Flag, prefix string) {
+		if values, ok := flagValueCompletions[flag.Name]; ok {
+			for _, value := range values(partial) {
+				add(prefix+value, "")
+			}
+		}
+	}
+	switch {
+	case expectsValue != nil:
+		addValues(expectsValue, "")
+	case strings.HasPrefix(partial, "-") && strings.Contains(partial, "="):
+		if flag := lookupFlag(cmd, partial); flag != nil {
+			addValues(flag, partial[:strings.Index(partial, "=")+1])
+		}
+	case strings.HasPrefix(partial, "-"):
+		cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+			if !flag.Hidden {
+				add("--"+flag.Name, flag.Usage)
+			}
+		})
+	default:
+		for _, sub := range cmd.Commands() {
+			// Cached project commands have no Run, which cobra counts as unavailable
+			if !sub.Hidden && sub.Deprecated == "" {
+				add(sub.Name(), sub.Short)
+				if completesQualified(partial) {
+					for _, alias := range sub.Aliases {
+						add(alias, sub.Short)
+					}
+				}
+			}
+		}
+		for _, arg := range cmd.ValidArgs {
+			add(arg, "")
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// Bash splits words on = and : too, candidates are cut down to the part after the word bash is completing
+const bashCompletionTmpl = `_{{ .ProjectName }}_complete() {
+	local line="${COMP_LINE:0:$COMP_POINT}"
+	local -a words
+	read -ra words <<< "$line"
+	if [[ -z "$line" || "$line" == *" " ]]; then
+		words+=("")
+	fi
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local partial="${words[${#words[@]}-1]}"
+	local strip=$(( ${#partial} - ${#cur} ))
+	if [[ "$cur" == "=" || "$cur" == ":" ]]; then
+		strip=${#partial}
+	fi
+	local IFS=$'\n'
+	local candidate
+	COMPREPLY=()
+	for candidate in $({{ .ProjectName }} __complete "${words[@]:1}" 2>/dev/null); do
+		candidate="${candidate%%$'\t'*}"
+		COMPREPLY+=("${candidate:$strip}")
+	done
+}
+complete -o default -F _{{ .ProjectName }}_complete {{ .ProjectName }}
+`
+
+const zshCompletionTmpl = `#compdef {{ .ProjectName }}
+_{{ .ProjectName }}() {
+	local -a completions
+	local candidate
+	for candidate in "${(@f)$({{ .ProjectName }} __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+		[[ -z "$candidate" ]] && continue
+		completions+=("${${candidate%%$'\t'*}//:/\\:}:${candidate#*$'\t'}")
+	done
+	if (( ${#completions} )); then
+		_describe '{{ .ProjectName }}' completions
+	else
+		_files
+	fi
+}
+compdef _{{ .ProjectName }} {{ .ProjectName }}
+`
+
+const fishCompletionTmpl = `function __{{ .ProjectName }}_complete
+	{{ .ProjectName }} __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c {{ .ProjectName }} -f -a '(__{{ .ProjectName }}_complete)'
+`
+
+var completionTmpls = map[string]string{
+	"bash": bashCompletionTmpl,
+	"zsh":  zshCompletionTmpl,
+	"fish": fishCompletionTmpl,
+}
+
+var completionCmd = &cobra.Command{
+	Use:       "completion bash|zsh|fish",
+	Short:     "Print the shell completion script",
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		tmpl, ok := completionTmpls[args[0]]
+		if !ok {
+			errExit(fmt.Errorf("unsupported shell %s, expected one of bash, zsh, fish", args[0]))
+		}
+		script, err := util.StringTemplate("completion", tmpl, struct{ ProjectName string }{ProjectName: venvy.ProjectName})
+		errExit(err)
+		fmt.Print(script)
+	},
+}
+
+var completeCmd = &cobra.Command{
+	Use:                "__complete [words...]",
+	Short:              "Print completion candidates for the last word",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, candidate := range completions(rootCmd, args) {
+			fmt.Println(candidate)
+		}
+	},
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompletionCacheIsPerDirectory(t *testing.T) {
+	inTempDir(t, func(root string) {
+		defer func(cachePath string) { completionCachePath = cachePath }(completionCachePath)
+		completionCachePath = filepath.Join(root, "completion_cache.json")
+		for _, name := range []string{"alpha", "beta"} {
+			dir := filepath.Join(root, name)
+			os.Mkdir(dir, 0700)
+			os.Chdir(dir)
+			writeCompletionCache([]*cachedProject{{Name: name, Qualified: name + ":" + name}})
+		}
+		for _, name := range []string{"alpha", "beta"} {
+			os.Chdir(filepath.Join(root, name))
+			cmds := cachedCommands()
+			if len(cmds) != 1 || cmds[0].Name() != name {
+				t.Errorf("cached commands in %s are %v, expected only %s", name, cmds, name)
+			}
+		}
+	})
+}
+
+func TestCompletionCacheDropsOldestDirectory(t *testing.T) {
+	inTempDir(t, func(root string) {
+		defer func(cachePath string) { completionCachePath = cachePath }(completionCachePath)
+		completionCachePath = filepath.Join(root, "completion_cache.json")
+		writeCompletionCache(nil)
+		for i := 0; i < maxCompletionDirs; i++ {
+			dir, err := ioutil.TempDir(root, "dir")
+			if err != nil {
+				t.Fatal(err)
+			}
+			os.Chdir(dir)
+			writeCompletionCache(nil)
+		}
+		cache, err := loadCompletionCache()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := cache.Dirs[root]; ok || len(cache.Dirs) != maxCompletionDirs {
+			t.Errorf("cache holds %d dirs, expected the first of %d to be dropped", len(cache.Dirs), maxCompletionDirs+1)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pnegahdar/venvy/util"
+	logger "github.com/sirupsen/logrus"
+)
+
+var discoveryCachePath = globalPath("discovery_cache.json")
+
+// What the git binary supports, detected once per binary
+type gitCapabilities struct {
+	Path              string `json:"path"`
+	ModTime           int64  `json:"mod_time"`
+	RecurseSubmodules bool   `json:"recurse_submodules"`
+}
+
+// Tracked config paths of a repo relative to its root, valid while the key matches
+type repoDiscovery struct {
+	Key   string   `json:"key"`
+	Paths []string `json:"paths"`
+}
+
+type discoveryCache struct {
+	Git   *gitCapabilities          `json:"git"`
+	Repos map[string]*repoDiscovery `json:"repos"`
+}
+
+func loadDiscoveryCache() *discoveryCache {
+	cache := &discoveryCache{}
+	data, err := ioutil.ReadFile(discoveryCachePath)
+	if err == nil {
+		err = json.Unmarshal(data, cache)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Debugf("ignoring discovery cache with err %s", err)
+	}
+	if cache.Repos == nil {
+		cache.Repos = map[string]*repoDiscovery{}
+	}
+	return cache
+}
+
+func (c *discoveryCache) write() {
+	data, err := json.Marshal(c)
+	if err != nil {
+		logger.Debugf("unable to marshal discovery cache with err %s", err)
+		return
+	}
+	err = ioutil.WriteFile(discoveryCachePath, data, 0600)
+	if err != nil {
+		logger.Debugf("unable to save discovery cache to %s with err %s", discoveryCachePath, err)
+	}
+}
+
+var gitVersionRe = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// Detects the capabilities of the git on PATH, reusing the cached ones while the binary is unchanged
+func (c *discoveryCache) gitCapabilities() *gitCapabilities {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return &gitCapabilities{}
+	}
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return &gitCapabilities{}
+	}
+	if c.Git != nil && c.Git.Path == gitPath && c.Git.ModTime == info.ModTime().UnixNano() {
+		return c.Git
+	}
+	capabilities := &gitCapabilities{Path: gitPath, ModTime: info.ModTime().UnixNano()}
+	data, err := exec.Command(gitPath, "version").Output()
+	if err != nil {
+		logger.Debugf("ran into err %s running git version", err)
+	}
+	if match := gitVersionRe.FindStringSubmatch(string(data)); match != nil {
+		major, _ := strconv.Atoi(match[1])
+		minor, _ := strconv.Atoi(match[2])
+		// ls-files takes pathspecs with --recurse-submodules since 2.12
+		capabilities.RecurseSubmodules = major > 2 || (major == 2 && minor >= 12)
+	}
+	logger.Debugf("Detected git %s: %+v", strings.TrimSpace(string(data)), capabilities)
+	c.Git = capabilities
+	return capabilities
+}
+
+// The git dir of a work tree, following the .git file of worktrees and submodules
+func gitDir(gitRoot string) string {
+	dotGit := path.Join(gitRoot, ".git")
+	data, err := ioutil.ReadFile(dotGit)
+	if err != nil || !strings.HasPrefix(string(data), "gitdir:") {
+		return dotGit
+	}
+	dir := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitRoot, dir)
+	}
+	return dir
+}
+
+// Changes whenever a checkout, commit, add or rm could have changed the tracked files
+func discoveryKey(gitRoot string) string {
+	dir := gitDir(gitRoot)
+	head, _ := ioutil.ReadFile(path.Join(dir, "HEAD"))
+	key := strings.TrimSpace(string(head))
+	for _, statPath := range []string{path.Join(dir, "index"), path.Join(gitRoot, ".gitmodules")} {
+		if info, err := os.Stat(statPath); err == nil {
+			key += fmt.Sprintf("|%d:%d", info.ModTime().UnixNano(), info.Size())
+		} else {
+			key += "|-"
+		}
+	}
+	return key
+}
+
+// Runs git ls-files from the root limited to config files, the paths are relative to the root
+func lsFilesConfigs(gitRoot string, args ...string) []string {
+	runArgs := append([]string{"--git-dir", path.Join(gitRoot, ".git"), "--work-tree", gitRoot, "ls-files", "--full-name"}, args...)
+	// Only config files are listed, git output in large repos is otherwise the bulk of the time spent
+	runArgs = append(runArgs, "--")
+	for _, name := range configFileNames {
+		runArgs = append(runArgs, "*"+name)
+	}
+	logger.Debugf("Running command: git %s", strings.Join(runArgs, " "))
+	cmd := exec.Command("git", runArgs...)
+	// ls-files only lists files under the cwd, run from the root so subdirectories see every config
+	cmd.Dir = gitRoot
+	data, err := cmd.Output()
+	if err != nil {
+		logger.Debugf("ran into err %s doing git ls-files", err)
+		return nil
+	}
+	paths := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if isConfigFile(line) {
+			paths = append(paths, line)
+		}
+	}
+	return paths
+}
+
+// The config files in the index, including those of submodules when git can list them
+func trackedGitConfigs(gitRoot string, capabilities *gitCapabilities) []string {
+	if capabilities.RecurseSubmodules && util.PathExists(path.Join(gitRoot, ".gitmodules")) {
+		return lsFilesConfigs(gitRoot, "--cached", "--recurse-submodules")
+	}
+	return lsFilesConfigs(gitRoot, "--cached")
+}
+
+// Untracked config files that aren't ignored, these don't change the discovery key so they're never cached
+func untrackedGitConfigs(gitRoot string) []string {
+	return lsFilesConfigs(gitRoot, "--others", "--exclude-standard")
+}
+
+// Configs in the git repo containing the cwd. The tracked ones are cached until the repo's HEAD or index changes,
+// untracked ones are listed on every run.
+func configPathsFromGit() []*foundConfig {
+	return gitConfigs(true)
+}
+
+// The tracked configs of the git repo containing the cwd if they're cached, git isn't run
+func cachedConfigPathsFromGit() []*foundConfig {
+	return gitConfigs(false)
+}
+
+func gitConfigs(runGit bool) []*foundConfig {
+	paths := []*foundConfig{}
+	gitRoot, err := util.FindPathInAncestors("", ".git")
+	if err != nil {
+		return paths
+	}
+	storageDir := dotDir(gitRoot)
+
+	cache := loadDiscoveryCache()
+	key := discoveryKey(gitRoot)
+	discovery, ok := cache.Repos[gitRoot]
+	if ok && discovery.Key == key {
+		logger.Debugf("Using cached discovery of %s", gitRoot)
+	} else if runGit {
+		discovery = &repoDiscovery{Key: key, Paths: trackedGitConfigs(gitRoot, cache.gitCapabilities())}
+		cache.Repos[gitRoot] = discovery
+		cache.write()
+	} else {
+		logger.Debugf("No cached discovery of %s", gitRoot)
+		return paths
+	}
+	relPaths := discovery.Paths
+	if runGit {
+		relPaths = append(append([]string{}, relPaths...), untrackedGitConfigs(gitRoot)...)
+	}
+	seenPaths := map[string]bool{}
+	for _, relPath := range relPaths {
+		if !seenPaths[relPath] {
+			seenPaths[relPath] = true
+			paths = append(paths, &foundConfig{Path: path.Join(gitRoot, relPath), StorageDir: storageDir})
+		}
+	}
+	logger.Debugf("Found %d configs in git dir.", len(paths))
+	return paths
+}
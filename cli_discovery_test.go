@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pnegahdar/venvy/util"
+)
+
+const benchmarkRepoFiles = 20000
+const benchmarkRepoConfigs = 20
+
+// A committed repo with benchmarkRepoFiles files spread over nested dirs, a few of them configs
+func makeBenchmarkRepo(b *testing.B) string {
+	root, err := ioutil.TempDir("", "venvy-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < benchmarkRepoFiles; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%d", i%100), fmt.Sprintf("sub%d", i%7))
+		name := fmt.Sprintf("file%d.go", i)
+		if i < benchmarkRepoConfigs {
+			name = defaultFileName
+		}
+		err = os.MkdirAll(dir, 0700)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, name), []byte("package bench\n"), 0600)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	commitAll(b, root)
+	return root
+}
+
+// Inits a repo in root if needed and commits everything in it
+func commitAll(tb testing.TB, root string) {
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"-c", "user.name=bench", "-c", "user.email=bench@example.com", "commit", "-qm", "bench"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			tb.Fatalf("git %v: %s %s", args, err, out)
+		}
+	}
+}
+
+func writeTestFile(tb testing.TB, filePath string, content string) {
+	err := os.MkdirAll(filepath.Dir(filePath), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(filePath, []byte(content), 0600)
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// Runs the test in a fresh dir with its own discovery cache, the dir is removed afterwards
+func inTempDir(t *testing.T, test func(root string)) {
+	root, err := ioutil.TempDir("", "venvy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	// macOS temp dirs are symlinks, configs are found by their real path
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workDir)
+	os.Chdir(root)
+	defer func(cachePath string) { discoveryCachePath = cachePath }(discoveryCachePath)
+	discoveryCachePath = filepath.Join(root, "discovery_cache.json")
+	test(root)
+}
+
+func foundPaths(found []*foundConfig) []string {
+	paths := []string{}
+	for _, config := range found {
+		paths = append(paths, config.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestConfigPathsFromGitFindsUntracked(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	inTempDir(t, func(root string) {
+		writeTestFile(t, filepath.Join(root, defaultFileName), "")
+		writeTestFile(t, filepath.Join(root, ".gitignore"), "ignored/\ndiscovery_cache.json\n")
+		commitAll(t, root)
+		tracked := filepath.Join(root, defaultFileName)
+
+		for i := 0; i < 2; i++ {
+			if found := foundPaths(configPathsFromGit()); !reflect.DeepEqual(found, []string{tracked}) {
+				t.Fatalf("run %d found %v, expected only %s", i, found, tracked)
+			}
+		}
+		if !util.PathExists(discoveryCachePath) {
+			t.Fatal("discovery cache not written")
+		}
+
+		// Created after the cache hit, the index and so the key are unchanged
+		untracked := filepath.Join(root, "sub", defaultFileName)
+		writeTestFile(t, untracked, "")
+		writeTestFile(t, filepath.Join(root, "ignored", defaultFileName), "")
+		if found := foundPaths(configPathsFromGit()); !reflect.DeepEqual(found, []string{untracked, tracked}) {
+			t.Errorf("found %v, expected %s and %s", found, untracked, tracked)
+		}
+
+		os.Remove(untracked)
+		if found := foundPaths(configPathsFromGit()); !reflect.DeepEqual(found, []string{tracked}) {
+			t.Errorf("found %v after removing the untracked config, expected only %s", found, tracked)
+		}
+	})
+}
+
+func BenchmarkConfigPathsFromGit(b *testing.B) {
+	if _, err := exec.LookPath("git"); err != nil {
+		b.Skip("git not installed")
+	}
+	root := makeBenchmarkRepo(b)
+	defer os.RemoveAll(root)
+	workDir, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.Chdir(workDir)
+	os.Chdir(filepath.Join(root, "pkg1"))
+	defer func(cachePath string) { discoveryCachePath = cachePath }(discoveryCachePath)
+	discoveryCachePath = filepath.Join(root, "discovery_cache.json")
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			os.Remove(discoveryCachePath)
+			b.StartTimer()
+			if found := configPathsFromGit(); len(found) != benchmarkRepoConfigs {
+				b.Fatalf("found %d configs, expected %d", len(found), benchmarkRepoConfigs)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		configPathsFromGit()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if found := configPathsFromGit(); len(found) != benchmarkRepoConfigs {
+				b.Fatalf("found %d configs, expected %d", len(found), benchmarkRepoConfigs)
+			}
+		}
+	})
+}
@@ -0,0 +1,70 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// The foreground process group of the terminal on fd, fails if fd is not a terminal
+func terminalForeground(fd int) (int, error) {
+	var pgid int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgid)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(pgid), nil
+}
+
+func setTerminalForeground(fd int, pgid int) error {
+	pgid32 := int32(pgid)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&pgid32)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Runs the child in its own process group, signals forwarded to it reach every process it starts
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Runs the child in its own process group moved to the foreground when we own the terminal, the returned func takes
+// the terminal back once the child is done.
+func setupExecGroup(cmd *exec.Cmd) (restore func()) {
+	setProcessGroup(cmd)
+	foreground, err := terminalForeground(0)
+	if err != nil || foreground != syscall.Getpgrp() {
+		return func() {}
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = 0
+	return func() {
+		// Changing the foreground from a background group stops us with SIGTTOU unless it is ignored
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		setTerminalForeground(0, syscall.Getpgrp())
+	}
+}
+
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) {
+	if unixSignal, ok := sig.(syscall.Signal); ok {
+		syscall.Kill(-cmd.Process.Pid, unixSignal)
+	}
+}
+
+// Exits the way the child did, dying from the same signal if it was killed by one
+func exitLike(state *os.ProcessState) {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		signal.Reset(status.Signal())
+		syscall.Kill(os.Getpid(), status.Signal())
+		os.Exit(128 + int(status.Signal()))
+	}
+	os.Exit(state.ExitCode())
+}
@@ -0,0 +1,24 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Windows has no process groups or job control to hand over, the child shares our console
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func setupExecGroup(cmd *exec.Cmd) (restore func()) {
+	return func() {}
+}
+
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) {
+	cmd.Process.Signal(sig)
+}
+
+func exitLike(state *os.ProcessState) {
+	os.Exit(state.ExitCode())
+}
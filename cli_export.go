@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/pnegahdar/venvy/shell"
+)
+
+var exportFormats = []string{"dotenv", "json", "docker", "systemd", "github"}
+
+// Vars sh manages itself, never exported
+var shellInternalEnvVars = map[string]bool{"PWD": true, "OLDPWD": true, "SHLVL": true, "_": true}
+
+// Parses the output of env -0, every entry ends in a NUL
+func parseEnvDump(data []byte) map[string]string {
+	env := map[string]string{}
+	for _, pair := range strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env
+}
+
+// A variable changed by the activation, Value is nil when it was unset
+type envChange struct {
+	Name  string
+	Value *string
+	// Entries the activation put in front of the old value, only for PATH
+	Prepended []string
+}
+
+// Runs the activation in sh without any rc files and diffs the environment before and after, script output goes to
+// stderr. Both dumps come from env -0 in the same sh, separated by an extra NUL.
+func activationEnv(activation *shell.Script) ([]*envChange, error) {
+	script := fmt.Sprintf("env -0 && printf '\\000' && {\n%s\n} 1>&2 && exec env -0", shell.Render(shell.Posix, activation))
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("activation failed: %s", err)
+	}
+	// Names are never empty so two NULs in a row only occur between the dumps
+	split := bytes.Index(output, []byte("\x00\x00"))
+	if split < 0 {
+		return nil, fmt.Errorf("unable to read the environment from env -0 output")
+	}
+	before, after := parseEnvDump(output[:split+1]), parseEnvDump(output[split+2:])
+
+	names := []string{}
+	for name := range after {
+		names = append(names, name)
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	changes := []*envChange{}
+	for _, name := range names {
+		oldValue, hadValue := before[name]
+		newValue, hasValue := after[name]
+		if shellInternalEnvVars[name] || (hadValue == hasValue && oldValue == newValue) {
+			continue
+		}
+		change := &envChange{Name: name}
+		if hasValue {
+			change.Value = &newValue
+		}
+		if name == "PATH" && hasValue && strings.HasSuffix(newValue, ":"+oldValue) {
+			change.Prepended = strings.Split(strings.TrimSuffix(newValue, ":"+oldValue), ":")
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// Values that need no quoting are written as is, others are double quoted with escapes dotenv parsers expand
+func dotenvQuote(value string) string {
+	if value != "" && shell.Quote(value) == value {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// Writes the changes in the format, formats that can't unset variables or hold multi line values skip them with a
+// warning written to warnOut
+func writeExport(out, warnOut io.Writer, format string, changes []*envChange) error {
+	if format == "json" {
+		values := map[string]*string{}
+		for _, change := range changes {
+			values[change.Name] = change.Value
+		}
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	if format == "github" {
+		return writeGithubExport(out, warnOut, changes)
+	}
+	for _, change := range changes {
+		if change.Value == nil {
+			fmt.Fprintf(warnOut, "warning: %s is unset by the activation which %s can't express, skipping\n", change.Name, format)
+			continue
+		}
+		value := *change.Value
+		switch format {
+		case "dotenv":
+			fmt.Fprintf(out, "%s=%s\n", change.Name, dotenvQuote(value))
+		case "docker":
+			if strings.Contains(value, "\n") {
+				fmt.Fprintf(warnOut, "warning: %s has a multi line value which docker env files can't hold, skipping\n", change.Name)
+				continue
+			}
+			fmt.Fprintf(out, "%s=%s\n", change.Name, value)
+		case "systemd":
+			replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "\n", `\n`)
+			fmt.Fprintf(out, "Environment=\"%s=%s\"\n", change.Name, replacer.Replace(value))
+		}
+	}
+	return nil
+}
+
+// Appends to the files GitHub Actions reads between steps, outside of a workflow both parts are written to out instead
+func writeGithubExport(out, warnOut io.Writer, changes []*envChange) error {
+	envOut, pathOut := out, out
+	envPath, pathPath := os.Getenv("GITHUB_ENV"), os.Getenv("GITHUB_PATH")
+	if envPath != "" && pathPath != "" {
+		envF, err := os.OpenFile(envPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		defer envF.Close()
+		pathF, err := os.OpenFile(pathPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		defer pathF.Close()
+		envOut, pathOut = envF, pathF
+	} else {
+		fmt.Fprintln(out, "# GITHUB_ENV")
+	}
+	var prepended []string
+	for _, change := range changes {
+		if change.Value == nil {
+			fmt.Fprintf(warnOut, "warning: %s is unset by the activation which GITHUB_ENV can't express, skipping\n", change.Name)
+			continue
+		}
+		if change.Prepended != nil {
+			prepended = change.Prepended
+			continue
+		}
+		value := *change.Value
+		if strings.Contains(value, "\n") {
+			delimiter := fmt.Sprintf("%s_EOF", strings.ToUpper(venvy.ProjectName))
+			for strings.Contains(value, delimiter) {
+				delimiter += "_"
+			}
+			fmt.Fprintf(envOut, "%s<<%s\n%s\n%s\n", change.Name, delimiter, value, delimiter)
+		} else {
+			fmt.Fprintf(envOut, "%s=%s\n", change.Name, value)
+		}
+	}
+	if envPath == "" || pathPath == "" {
+		fmt.Fprintln(out, "# GITHUB_PATH")
+	}
+	// Every line is put in front of PATH so the first entry goes last
+	for i := len(prepended) - 1; i >= 0; i-- {
+		fmt.Fprintln(pathOut, prepended[i])
+	}
+	return nil
+}
+
+// The variables the activation sets, the prompt and jump builtins are left out as they only matter to interactive shells
+func issueExport(manager *venvy.ProjectManager, format string) {
+	known := false
+	for _, exportFormat := range exportFormats {
+		known = known || format == exportFormat
+	}
+	if !known {
+		errExit(fmt.Errorf("unknown export format %s, expected one of %s", format, strings.Join(exportFormats, ", ")))
+	}
+	// Only the module environment, the metadata describes an activation in this shell
+	activate, deactivate, err := projectBlocks(manager, nil)
+	errExit(err)
+	if dryRun {
+		printDryRun(shell.Posix, nil, activate, deactivate)
+		return
+	}
+	changes, err := activationEnv(joinBlocks(activate))
+	errExit(err)
+	errExit(writeExport(os.Stdout, os.Stderr, format, changes))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteExport(t *testing.T) {
+	value := func(value string) *string {
+		return &value
+	}
+	changes := []*envChange{
+		{Name: "GONE"},
+		{Name: "MULTI", Value: value("a\nb")},
+		{Name: "PATH", Value: value("/one:/two:/bin"), Prepended: []string{"/one", "/two"}},
+		{Name: "PLAIN", Value: value(`it's "100%" $HOME`)},
+	}
+	cases := []struct {
+		format   string
+		want     string
+		warnings []string
+	}{
+		{
+			format:   "dotenv",
+			want:     "MULTI=\"a\\nb\"\nPATH=/one:/two:/bin\nPLAIN=\"it's \\\"100%\\\" \\$HOME\"\n",
+			warnings: []string{"GONE is unset"},
+		},
+		{
+			format: "json",
+			want:   "{\n  \"GONE\": null,\n  \"MULTI\": \"a\\nb\",\n  \"PATH\": \"/one:/two:/bin\",\n  \"PLAIN\": \"it's \\\"100%\\\" $HOME\"\n}\n",
+		},
+		{
+			format:   "docker",
+			want:     "PATH=/one:/two:/bin\nPLAIN=it's \"100%\" $HOME\n",
+			warnings: []string{"GONE is unset", "MULTI has a multi line value"},
+		},
+		{
+			format:   "systemd",
+			want:     "Environment=\"MULTI=a\\nb\"\nEnvironment=\"PATH=/one:/two:/bin\"\nEnvironment=\"PLAIN=it's \\\"100%%\\\" $HOME\"\n",
+			warnings: []string{"GONE is unset"},
+		},
+		{
+			format:   "github",
+			want:     "# GITHUB_ENV\nMULTI<<VENVY_EOF\na\nb\nVENVY_EOF\nPLAIN=it's \"100%\" $HOME\n# GITHUB_PATH\n/two\n/one\n",
+			warnings: []string{"GONE is unset"},
+		},
+	}
+	for _, name := range []string{"GITHUB_ENV", "GITHUB_PATH"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	for _, tc := range cases {
+		t.Run(tc.format, func(t *testing.T) {
+			out, warnOut := &bytes.Buffer{}, &bytes.Buffer{}
+			if err := writeExport(out, warnOut, tc.format, changes); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("got\n%s\nexpected\n%s", out, tc.want)
+			}
+			if warnings := strings.Count(warnOut.String(), "warning: "); warnings != len(tc.warnings) {
+				t.Errorf("got %d warnings, expected %d:\n%s", warnings, len(tc.warnings), warnOut)
+			}
+			for _, warning := range tc.warnings {
+				if !strings.Contains(warnOut.String(), warning) {
+					t.Errorf("warnings don't contain %q:\n%s", warning, warnOut)
+				}
+			}
+		})
+	}
+}
+
+func TestExportActivation(t *testing.T) {
+	inTempDir(t, func(root string) {
+		writeTestFile(t, filepath.Join(root, defaultFileName), `[[modules]]
+name = "vars"
+type = "env"
+	[modules.config]
+	unset_vars = ["VENVY_TEST_GONE"]
+	[modules.config.vars]
+	VENVY_TEST_PLAIN = "1"
+	VENVY_TEST_MULTI = "a\nb"
+
+[[projects]]
+name = "acme"
+modules = ["vars"]
+`)
+		env := []string{"HOME=" + root, disableHistoryEnvVar + "=1", "VENVY_TEST_GONE=1"}
+		out, exitCode := runMain(t, root, env, "acme", "--export=docker")
+		if exitCode != 0 {
+			t.Fatalf("exited with %d:\n%s", exitCode, out)
+		}
+		if want := "VENVY_TEST_PLAIN=1\n"; out != want {
+			t.Errorf("got\n%s\nexpected\n%s", out, want)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pnegahdar/venvy/manager"
+	logger "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Every config in the history file, a missing file is an empty history
+func readHistory() ([]*foundConfig, error) {
+	foundConfigs := []*foundConfig{}
+	data, err := ioutil.ReadFile(seenConfigsPath)
+	if os.IsNotExist(err) {
+		return foundConfigs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &foundConfigs)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range foundConfigs {
+		// Recorded before last seen times were, counted from now so upgrading doesn't expire everything
+		if config.LastSeen.IsZero() {
+			config.LastSeen = time.Now()
+		}
+	}
+	return foundConfigs, nil
+}
+
+func writeHistory(foundConfigs []*foundConfig) error {
+	data, err := json.Marshal(foundConfigs)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(seenConfigsPath), 0700)
+	return ioutil.WriteFile(seenConfigsPath, data, 0600)
+}
+
+// Parses a time.ParseDuration duration or a whole number of days like 30d
+func parseMaxAge(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+// How long a config may go unseen before it's dropped from history, 0 keeps it forever. The env var wins over the
+// user config.
+func historyMaxAge() time.Duration {
+	value := os.Getenv(historyMaxAgeEnvVar)
+	if value == "" {
+		value = userConfig().HistoryMaxAge
+	}
+	if value == "" {
+		return 0
+	}
+	maxAge, err := parseMaxAge(value)
+	if err != nil {
+		logger.Warnf("ignoring %s=%s, expected a duration like 720h or 30d: %s", historyMaxAgeEnvVar, value, err)
+		return 0
+	}
+	return maxAge
+}
+
+// Whole days once past a day, 6967h reads worse than 290d
+func formatAge(age time.Duration) string {
+	if age >= 24*time.Hour {
+		return fmt.Sprintf("%dd", age/(24*time.Hour))
+	}
+	return age.Round(time.Second).String()
+}
+
+// Why a history entry should be dropped, empty when it's kept
+func staleReason(config *foundConfig, maxAge time.Duration, now time.Time) string {
+	if _, err := os.Stat(config.Path); os.IsNotExist(err) {
+		return "missing"
+	}
+	if maxAge > 0 && now.Sub(config.LastSeen) > maxAge {
+		return fmt.Sprintf("not seen for %s", formatAge(now.Sub(config.LastSeen)))
+	}
+	return ""
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Manage the configs remembered from other directories",
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the configs in history",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		asJson, err := cmd.Flags().GetBool("json")
+		errExit(err)
+		history, err := readHistory()
+		errExit(err)
+		if asJson {
+			data, err := json.MarshalIndent(history, "", "  ")
+			errExit(err)
+			fmt.Println(string(data))
+			return
+		}
+		maxAge := historyMaxAge()
+		now := time.Now()
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "PATH\tLAST SEEN\tSTATUS")
+		for _, config := range history {
+			status := staleReason(config, maxAge, now)
+			if status == "" {
+				status = "ok"
+			}
+			fmt.Fprintf(table, "%s\t%s ago\t%s\n", config.Path, formatAge(now.Sub(config.LastSeen)), status)
+		}
+		table.Flush()
+	},
+}
+
+var historyForgetCmd = &cobra.Command{
+	Use:   "forget path [path...]",
+	Short: "Remove configs, or the configs in a directory, from history",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		history, err := readHistory()
+		errExit(err)
+		forget := map[string]bool{}
+		for _, arg := range args {
+			absPath, err := filepath.Abs(arg)
+			errExit(err)
+			matched := false
+			for _, config := range history {
+				if config.Path == absPath || filepath.Dir(config.Path) == absPath {
+					forget[config.Path] = true
+					matched = true
+				}
+			}
+			if !matched {
+				errExit(fmt.Errorf("no config in history at %s", absPath))
+			}
+		}
+		kept := []*foundConfig{}
+		for _, config := range history {
+			if forget[config.Path] {
+				fmt.Printf("Forgot %s\n", config.Path)
+				continue
+			}
+			kept = append(kept, config)
+		}
+		errExit(writeHistory(kept))
+	},
+}
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: fmt.Sprintf("Remove missing configs and ones not seen within %s from history", historyMaxAgeEnvVar),
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		history, err := readHistory()
+		errExit(err)
+		maxAge := historyMaxAge()
+		now := time.Now()
+		kept := []*foundConfig{}
+		for _, config := range history {
+			if reason := staleReason(config, maxAge, now); reason != "" {
+				fmt.Printf("Pruned %s (%s)\n", config.Path, reason)
+				continue
+			}
+			kept = append(kept, config)
+		}
+		errExit(writeHistory(kept))
+	},
+}
+
+var historyClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every config from history",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		history, err := readHistory()
+		errExit(err)
+		errExit(writeHistory([]*foundConfig{}))
+		fmt.Printf("Forgot %d configs, configs in git or the current directory are found again on the next %s run\n", len(history), venvy.ProjectName)
+	},
+}
+
+func init() {
+	historyListCmd.Flags().Bool("json", false, "print the history as json")
+	historyCmd.AddCommand(historyListCmd, historyForgetCmd, historyPruneCmd, historyClearCmd)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseMaxAge(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30d", want: 30 * 24 * time.Hour},
+		{value: "1d", want: 24 * time.Hour},
+		{value: "0d", want: 0},
+		{value: "720h", want: 720 * time.Hour},
+		{value: "90m", want: 90 * time.Minute},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "", wantErr: true},
+		{value: "30", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "1.5d", wantErr: true},
+		{value: "30days", wantErr: true},
+		{value: "month", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := parseMaxAge(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseMaxAge(%q) = %s, expected an error", tc.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseMaxAge(%q) = %s, %v, expected %s", tc.value, got, err, tc.want)
+		}
+	}
+}
+
+func TestStaleReason(t *testing.T) {
+	dir, err := ioutil.TempDir("", "venvy-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := filepath.Join(dir, defaultFileName)
+	if err := ioutil.WriteFile(existing, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "gone", defaultFileName)
+	now := time.Now()
+	cases := []struct {
+		name     string
+		path     string
+		lastSeen time.Time
+		maxAge   time.Duration
+		want     string
+	}{
+		{name: "recent", path: existing, lastSeen: now.Add(-time.Hour), maxAge: 24 * time.Hour, want: ""},
+		{name: "no max age", path: existing, lastSeen: now.Add(-1000 * 24 * time.Hour), want: ""},
+		{name: "too old", path: existing, lastSeen: now.Add(-40 * 24 * time.Hour), maxAge: 30 * 24 * time.Hour, want: "not seen for 40d"},
+		{name: "too old by hours", path: existing, lastSeen: now.Add(-3 * time.Hour), maxAge: time.Hour, want: "not seen for 3h0m0s"},
+		{name: "missing", path: missing, lastSeen: now, want: "missing"},
+		{name: "missing wins over age", path: missing, lastSeen: now.Add(-40 * 24 * time.Hour), maxAge: time.Hour, want: "missing"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := staleReason(&foundConfig{Path: tc.path, LastSeen: tc.lastSeen}, tc.maxAge, now)
+			if got != tc.want {
+				t.Errorf("got %q, expected %q", got, tc.want)
+			}
+		})
+	}
+}
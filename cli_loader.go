@@ -3,13 +3,16 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,9 +21,28 @@ import (
 	"github.com/pnegahdar/venvy/manager"
 	"github.com/pnegahdar/venvy/util"
 	logger "github.com/sirupsen/logrus"
+	"gopkg.in/go-playground/validator.v9"
 )
 
 var defaultFileName = fmt.Sprintf("%s.toml", venvy.ProjectName)
+
+// Discovered config file names, all formats convert to the same json before loading
+var configFileNames = []string{
+	defaultFileName,
+	fmt.Sprintf("%s.yaml", venvy.ProjectName),
+	fmt.Sprintf("%s.yml", venvy.ProjectName),
+	fmt.Sprintf("%s.json", venvy.ProjectName),
+}
+
+func isConfigFile(filePath string) bool {
+	for _, name := range configFileNames {
+		if strings.HasSuffix(filePath, name) {
+			return true
+		}
+	}
+	return false
+}
+
 var seenConfigsPath = globalPath("seen_configs.json")
 var scriptDocstringRe = regexp.MustCompile(`^[\-;#/\s}{]+["']([^"']+)["']$`)
 
@@ -50,31 +72,170 @@ type foundConfig struct {
 	Path           string                    `json:"path"`
 	StorageDir     string                    `json:"storage_dir"`
 	ProjectScripts map[string][]*foundScript `json:"known_scripts"`
+	LastSeen       time.Time                 `json:"last_seen"` // Last discovered other than through history
 	config         *venvy.Config
+	loadErr        error
 	loadOnce       sync.Once
-	scriptsOnce    sync.Once
+	scriptsLock    sync.Mutex
+	scriptsLoaded  map[string]bool
 }
 
-func (f *foundConfig) loadConfig() {
-	data, err := ioutil.ReadFile(f.Path)
+// A config load failure pinned to the file, and line when known, that caused it
+type configError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *configError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+// Toml errors read "Near line N", yaml ones "line N"
+var errorLineRe = regexp.MustCompile(`(?i)\bline (\d+)`)
+
+// The key strict decoding rejected, see util.UnmarshalStrict
+var unknownKeyRe = regexp.MustCompile(`unknown config key "(.*?)"`)
+
+// Matches the line setting key as `key = `, `key: ` or `"key": `
+func keyLineRe(key string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`^\s*-?\s*["']?%s["']?\s*[=:]`, regexp.QuoteMeta(key)))
+}
+
+// Matches a `name = "value"`, `name: value` or `"name": "value"` line
+func nameLineRe(value string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`^\s*-?\s*"?[Nn]ame"?\s*[=:]\s*["']?%s["']?\s*,?\s*$`, regexp.QuoteMeta(value)))
+}
+
+func newConfigError(configPath string, data []byte, err error) *configError {
+	configErr := &configError{Path: configPath, Err: err}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var validationErrs validator.ValidationErrors
+	isJson := strings.ToLower(filepath.Ext(configPath)) == ".json"
+	switch {
+	case isJson && errors.As(err, &syntaxErr):
+		configErr.Line = util.LineOfOffset(data, syntaxErr.Offset)
+	case isJson && errors.As(err, &typeErr):
+		configErr.Line = util.LineOfOffset(data, typeErr.Offset)
+	case errors.As(err, &validationErrs):
+		// Point at the offending value when it's written in the file
+		value := fmt.Sprint(validationErrs[0].Value())
+		if value != "" {
+			configErr.Line = util.FindLine(data, regexp.MustCompile(regexp.QuoteMeta(value)))
+		}
+	case unknownKeyRe.MatchString(err.Error()):
+		configErr.Line = util.FindLine(data, keyLineRe(unknownKeyRe.FindStringSubmatch(err.Error())[1]))
+	default:
+		if match := errorLineRe.FindStringSubmatch(err.Error()); match != nil {
+			configErr.Line, _ = strconv.Atoi(match[1])
+		}
+	}
+	return configErr
+}
+
+// Later definitions replace earlier ones of the same name in place
+func mergeConfig(into *venvy.Config, from *venvy.Config) {
+	for _, module := range from.Modules {
+		replaced := false
+		for i, existing := range into.Modules {
+			if existing.Name == module.Name {
+				logger.Debugf("module %s from %s overrides the one from %s", module.Name, module.SourcePath, existing.SourcePath)
+				into.Modules[i] = module
+				replaced = true
+			}
+		}
+		if !replaced {
+			into.Modules = append(into.Modules, module)
+		}
+	}
+	for _, project := range from.Projects {
+		replaced := false
+		for i, existing := range into.Projects {
+			if existing.Name == project.Name {
+				logger.Debugf("project %s from %s overrides the one from %s", project.Name, project.SourcePath, existing.SourcePath)
+				into.Projects[i] = project
+				replaced = true
+			}
+		}
+		if !replaced {
+			into.Projects = append(into.Projects, project)
+		}
+	}
+}
+
+// Loads a config file and everything it includes, includes are merged first so the including file wins
+func loadConfigFile(configPath string, includeStack []string) (*venvy.Config, error) {
+	for i, included := range includeStack {
+		if included == configPath {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(includeStack[i:], configPath), " -> "))
+		}
+	}
+	includeStack = append(includeStack, configPath)
+	data, err := ioutil.ReadFile(configPath)
 	if err != nil {
-		logger.Debugf("unable to read config with error %s", err)
-		return
+		return nil, &configError{Path: configPath, Err: err}
 	}
-	jsonData, err := util.TomlToJson(data)
+	jsonData, err := util.ConfigToJson(configPath, data)
 	if err != nil {
-		logger.Warnf("unable to convert config with error %s", err)
-		return
+		return nil, newConfigError(configPath, data, fmt.Errorf("unable to parse config: %w", err))
+	}
+	fileConfig := &venvy.Config{}
+	err = json.Unmarshal(jsonData, fileConfig)
+	if err != nil {
+		return nil, newConfigError(configPath, data, fmt.Errorf("unable to unmarshal config: %w", err))
 	}
-	newConfig := &venvy.Config{}
-	err = json.Unmarshal(jsonData, newConfig)
+	err = util.ValidateStruct(fileConfig)
 	if err != nil {
-		logger.Warnf("unable to unmarshal config with error %s", err)
+		return nil, newConfigError(configPath, data, fmt.Errorf("unable to validate config: %w", err))
+	}
+	for _, module := range fileConfig.Modules {
+		module.SourcePath = configPath
+	}
+	for _, project := range fileConfig.Projects {
+		project.SourcePath = configPath
+	}
+
+	merged := &venvy.Config{}
+	for _, include := range fileConfig.Include {
+		includePath := util.MustExpandPath(include)
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(configPath), includePath)
+		}
+		includedConfig, err := loadConfigFile(filepath.Clean(includePath), includeStack)
+		if err != nil {
+			var includedErr *configError
+			if errors.As(err, &includedErr) && (includedErr.Line > 0 || includedErr.Path != filepath.Clean(includePath)) {
+				// Already pinned to a line in the included files
+				return nil, err
+			}
+			return nil, &configError{
+				Path: configPath,
+				Line: util.FindLine(data, regexp.MustCompile(regexp.QuoteMeta(include))),
+				Err:  fmt.Errorf("unable to include %s: %s", include, err),
+			}
+		}
+		mergeConfig(merged, includedConfig)
+	}
+	mergeConfig(merged, fileConfig)
+	merged.Include = fileConfig.Include
+	merged.Namespace = fileConfig.Namespace
+	return merged, nil
+}
+
+func (f *foundConfig) loadConfig() {
+	if _, err := os.Stat(f.Path); err != nil {
+		logger.Debugf("unable to read config with error %s", err)
+		f.loadErr = err
 		return
 	}
-	err = util.ValidateStruct(newConfig)
+	newConfig, err := loadConfigFile(f.Path, nil)
 	if err != nil {
-		logger.Warnf("unable to validate config with error %s", err)
+		logger.Warnf("unable to load config %s, run `%s validate` for details: %s", f.Path, venvy.ProjectName, err)
+		f.loadErr = err
 		return
 	}
 
@@ -143,158 +304,237 @@ func extractScript(path string, f os.FileInfo) (*foundScript, error) {
 	return script, nil
 }
 
-func (f *foundConfig) loadScripts() {
-	f.scriptsOnce.Do(func() {
-		allScripts := map[string][]*foundScript{}
-		config := f.Config()
-		if config == nil {
-			return
+// Script subcommands of a project, relative sources are resolved against the config dir
+func (f *foundConfig) loadScripts(project *venvy.Project) []*foundScript {
+	projectScripts := []*foundScript{}
+	if len(project.ScriptSubcommands) == 0 {
+		return projectScripts
+	}
+	scriptCacheF := path.Join(f.StorageDir, project.Name, fmt.Sprintf("script_cache_%s.json", project.Name))
+	os.MkdirAll(path.Dir(scriptCacheF), 0700)
+	data, _ := ioutil.ReadFile(scriptCacheF)
+	cacheFnameScripts := map[string]*foundScript{}
+	err := util.UnmarshalEmpty(data, &cacheFnameScripts)
+	if err != nil {
+		logger.Debugf("unable to load cache scripts for project %s with err %s", project.Name, err)
+	}
+	for _, scSource := range project.ScriptSubcommands {
+		if !path.IsAbs(scSource) {
+			scSource = path.Join(path.Dir(venvy.DefinedIn(project.SourcePath, f.Path)), scSource)
+		}
+		fInfo, err := os.Stat(scSource)
+		if err != nil {
+			logger.Warnf("unable to load scripts from %s for project %s", scSource, project.Name)
+			continue
+		}
+		var files []os.FileInfo
+		if fInfo.IsDir() {
+			files, err = ioutil.ReadDir(scSource)
+		} else {
+			files = []os.FileInfo{fInfo}
+			scSource = path.Dir(scSource)
 		}
-		for _, project := range config.Projects {
-			scriptCacheF := path.Join(f.StorageDir, project.Name, fmt.Sprintf("script_cache_%s.json", project.Name))
-			if len(project.ScriptSubcommands) == 0 {
-				continue
-			}
-			os.MkdirAll(path.Dir(scriptCacheF), 0700)
-			data, _ := ioutil.ReadFile(scriptCacheF)
-			cacheFnameScripts := map[string]*foundScript{}
-			err := util.UnmarshalEmpty(data, &cacheFnameScripts)
-			if err != nil {
-				logger.Debugf("unable to load cache scripts for project %s with err %s", project.Name, err)
-			}
-			for _, scSource := range project.ScriptSubcommands {
-				if !path.IsAbs(scSource) {
-					scSource = path.Join(path.Dir(f.Path), scSource)
-				}
-				fInfo, err := os.Stat(scSource)
-				if err != nil {
-					logger.Warnf("unable to load scripts from %s for project %s", scSource, project.Name)
-					continue
-				}
-				var files []os.FileInfo
-				if fInfo.IsDir() {
-					files, err = ioutil.ReadDir(scSource)
-				} else {
-					files = []os.FileInfo{fInfo}
-					scSource = path.Dir(scSource)
-				}
 
-				for _, file := range files {
-					fname := path.Join(scSource, file.Name())
-					cachedScript, ok := cacheFnameScripts[fname]
-					if ok && file.ModTime().Format(time.RFC3339) == cachedScript.LastModified {
-						allScripts[project.Name] = append(allScripts[project.Name], cachedScript)
-					} else {
-						parsedScript, err := extractScript(fname, file)
-						if err != nil {
-							logger.Warnf("unable to load scripts from %s for project %s", fname, project.Name)
-							continue
-						}
-						allScripts[project.Name] = append(allScripts[project.Name], parsedScript)
-						cacheFnameScripts[fname] = parsedScript
-					}
-				}
-			}
-			if len(cacheFnameScripts) > 0 {
-				cacheJson, err := json.Marshal(cacheFnameScripts)
+		for _, file := range files {
+			fname := path.Join(scSource, file.Name())
+			cachedScript, ok := cacheFnameScripts[fname]
+			if ok && file.ModTime().Format(time.RFC3339) == cachedScript.LastModified {
+				projectScripts = append(projectScripts, cachedScript)
+			} else {
+				parsedScript, err := extractScript(fname, file)
 				if err != nil {
-					logger.Warnf("unable to marshal cache scripts for project %s with err %s", project.Name, err)
-				}
-				err = ioutil.WriteFile(scriptCacheF, cacheJson, 0600)
-				if err != nil {
-					logger.Warnf("unable to save cache scripts for project %s with err %s", project.Name, err)
+					logger.Warnf("unable to load scripts from %s for project %s", fname, project.Name)
+					continue
 				}
+				projectScripts = append(projectScripts, parsedScript)
+				cacheFnameScripts[fname] = parsedScript
 			}
 		}
-		f.ProjectScripts = allScripts
-	})
-
-}
-
-func (f *foundConfig) Scripts() map[string][]*foundScript {
-	f.loadScripts()
-	return f.ProjectScripts
-}
-
-func configPathsFromGit() []*foundConfig {
-	paths := []*foundConfig{}
-	seenPaths := map[string]bool{}
-	gitRoot, err := util.FindPathInAncestors("", ".git")
-	storageDir := dotDir(gitRoot)
-	if err != nil {
-		return paths
 	}
-	dotGitDir := path.Join(gitRoot, ".git")
-	baseArgs := []string{"--git-dir", dotGitDir, "--work-tree", gitRoot}
-
-	addedFilesArgs := []string{"ls-files", "--others", "--exclude-standard", "--full-name"}
-	lsSubmodulesArgs := []string{"ls-files", "--recurse-submodules", "--full-name"}
-	// TODO: older versions of git don't have --recurse submodules, perhaps detect instead of trying again
-	lsNoSubmodules := []string{"ls-files", "--full-name"}
-
-	for _, args := range [][]string{addedFilesArgs, lsSubmodulesArgs, lsNoSubmodules} {
-		runArgs := append(baseArgs, args...)
-		logger.Debugf("Running command: git %s", strings.Join(runArgs, " "))
-		cmd := exec.Command("git", runArgs...)
-		data, err := cmd.Output()
+	if len(cacheFnameScripts) > 0 {
+		cacheJson, err := json.Marshal(cacheFnameScripts)
 		if err != nil {
-			logger.Debugf("ran into err %s doing git ls-files", err)
-		} else {
-			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
-			for _, line := range lines {
-				if strings.HasSuffix(line, defaultFileName) {
-					fullPath := path.Join(gitRoot, line)
-					if _, ok := seenPaths[fullPath]; !ok {
-						paths = append(paths, &foundConfig{Path: fullPath, StorageDir: storageDir})
-						seenPaths[fullPath] = true
-					}
-				}
-			}
+			logger.Warnf("unable to marshal cache scripts for project %s with err %s", project.Name, err)
+		}
+		err = ioutil.WriteFile(scriptCacheF, cacheJson, 0600)
+		if err != nil {
+			logger.Warnf("unable to save cache scripts for project %s with err %s", project.Name, err)
 		}
 	}
-	logger.Debugf("Found %d configs in git dir.", len(paths))
-	return paths
+	return projectScripts
 }
 
+// Takes the resolved project so scripts inherited through extends are included
+func (f *foundConfig) Scripts(project *venvy.Project) []*foundScript {
+	f.scriptsLock.Lock()
+	defer f.scriptsLock.Unlock()
+	if f.scriptsLoaded[project.Name] {
+		return f.ProjectScripts[project.Name]
+	}
+	if f.scriptsLoaded == nil {
+		f.ProjectScripts = map[string][]*foundScript{}
+		f.scriptsLoaded = map[string]bool{}
+	}
+	f.ProjectScripts[project.Name] = f.loadScripts(project)
+	f.scriptsLoaded[project.Name] = true
+	return f.ProjectScripts[project.Name]
+}
+
+// History entries still worth loading, missing files and entries past the max age are dropped
 func configPathsFromHistory() []*foundConfig {
-	foundConfigs := []*foundConfig{}
-	data, err := ioutil.ReadFile(seenConfigsPath)
+	history, err := readHistory()
 	if err != nil {
 		logger.Debugf("ran into err reading seen configs %s", err)
 		return nil
 	}
-	err = json.Unmarshal(data, &foundConfigs)
-	if err != nil {
-		logger.Debugf("ran into err unmarshaling seen configs %s", err)
-		return nil
+	foundConfigs := []*foundConfig{}
+	maxAge := historyMaxAge()
+	now := time.Now()
+	for _, config := range history {
+		if reason := staleReason(config, maxAge, now); reason != "" {
+			logger.Debugf("Dropping config %s from history: %s", config.Path, reason)
+			continue
+		}
+		foundConfigs = append(foundConfigs, config)
 	}
 	logger.Debugf("Found %d configs in history.", len(foundConfigs))
 	return foundConfigs
 }
 
+// Configs directly in dir, data is stored next to them
+func configsInDir(dir string) []*foundConfig {
+	foundConfigs := []*foundConfig{}
+	for _, name := range configFileNames {
+		inDirConfig := path.Join(dir, name)
+		if util.PathExists(inDirConfig) {
+			foundConfigs = append(foundConfigs, &foundConfig{Path: inDirConfig, StorageDir: dotDir(dir)})
+		}
+	}
+	return foundConfigs
+}
+
 func configsPathsFromPwd() []*foundConfig {
 	workDir, err := os.Getwd()
 	if err != nil {
 		logger.Debugf("ran into err getting cwd %s", err)
 		return nil
 	}
-	inDirConfig := path.Join(workDir, defaultFileName)
-	_, err = os.Stat(inDirConfig)
-	if err != nil {
+	foundConfigs := configsInDir(workDir)
+	if len(foundConfigs) == 0 {
 		logger.Debugf("no config found in current directory")
+	}
+	return foundConfigs
+}
+
+// Configs in the directories above the cwd
+func configPathsFromAncestors() []*foundConfig {
+	workDir, err := os.Getwd()
+	if err != nil {
+		logger.Debugf("ran into err getting cwd %s", err)
 		return nil
 	}
-	return []*foundConfig{{Path: inDirConfig, StorageDir: dotDir(workDir)}}
+	foundConfigs := []*foundConfig{}
+	if workDir == "/" {
+		return foundConfigs
+	}
+	for _, name := range configFileNames {
+		start := path.Dir(workDir)
+		for {
+			dir, err := util.FindPathInAncestors(start, name)
+			if err != nil {
+				break
+			}
+			foundConfigs = append(foundConfigs, &foundConfig{Path: path.Join(dir, name), StorageDir: dotDir(dir)})
+			if dir == "/" {
+				break
+			}
+			start = path.Dir(dir)
+		}
+	}
+	logger.Debugf("Found %d configs in parent directories.", len(foundConfigs))
+	return foundConfigs
 }
 
-func LoadConfigs(prefetch bool, useHistory bool) []*foundConfig {
-	allDiscovered := [][]*foundConfig{
-		configPathsFromGit(),
-		configsPathsFromPwd(),
+// Configs in the files and directories listed in VENVY_PATH and then the search paths of the user config
+func configPathsFromSearchPath() []*foundConfig {
+	foundConfigs := []*foundConfig{}
+	for _, entry := range append(filepath.SplitList(os.Getenv(searchPathEnvVar)), userConfig().SearchPaths...) {
+		if entry == "" {
+			continue
+		}
+		entryPath, err := filepath.Abs(util.MustExpandPath(entry))
+		if err != nil {
+			logger.Warnf("ignoring search path %s: %s", entry, err)
+			continue
+		}
+		info, err := os.Stat(entryPath)
+		if err != nil {
+			logger.Warnf("ignoring search path %s: %s", entry, err)
+			continue
+		}
+		if info.IsDir() {
+			foundConfigs = append(foundConfigs, configsInDir(entryPath)...)
+		} else {
+			foundConfigs = append(foundConfigs, &foundConfig{Path: entryPath, StorageDir: dotDir(filepath.Dir(entryPath))})
+		}
 	}
-	if useHistory {
-		allDiscovered = append(allDiscovered, configPathsFromHistory())
+	logger.Debugf("Found %d configs in search paths.", len(foundConfigs))
+	return foundConfigs
+}
+
+// Separates a config's namespace from the project name in qualified commands
+const namespaceSeparator = ":"
+
+// The config's namespace, or the name of the git repo or dir containing it
+func configNamespace(configF *foundConfig) string {
+	if config := configF.Config(); config != nil && config.Namespace != "" {
+		return config.Namespace
 	}
+	configDir := filepath.Dir(configF.Path)
+	if gitRoot, err := util.FindPathInAncestors(configDir, ".git"); err == nil {
+		return filepath.Base(gitRoot)
+	}
+	return filepath.Base(configDir)
+}
+
+func qualifiedName(namespace string, projectName string) string {
+	return namespace + namespaceSeparator + projectName
+}
+
+func bareProjectName(name string) string {
+	return name[strings.LastIndex(name, namespaceSeparator)+1:]
+}
+
+// Directory steps from dir to the config's dir, up to their common parent and down again
+func configDistance(dir string, configPath string) int {
+	rel, err := filepath.Rel(dir, filepath.Dir(configPath))
+	if err != nil {
+		return math.MaxInt32
+	}
+	if rel == "." {
+		return 0
+	}
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
+
+// Orders configs nearest to the cwd first, ties by path, so precedence doesn't depend on discovery order
+func sortByProximity(foundConfigs []*foundConfig) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		logger.Debugf("ran into err getting cwd %s", err)
+		return
+	}
+	sort.SliceStable(foundConfigs, func(i, j int) bool {
+		distanceI, distanceJ := configDistance(workDir, foundConfigs[i].Path), configDistance(workDir, foundConfigs[j].Path)
+		if distanceI != distanceJ {
+			return distanceI < distanceJ
+		}
+		return foundConfigs[i].Path < foundConfigs[j].Path
+	})
+}
+
+// The first config found at each path, nearest to the cwd first
+func dedupeConfigs(allDiscovered [][]*foundConfig, prefetch bool) []*foundConfig {
 	uniqueConfigs := []*foundConfig{}
 	pathsSeen := map[string]bool{}
 	for _, discoveredConfigs := range allDiscovered {
@@ -303,21 +543,50 @@ func LoadConfigs(prefetch bool, useHistory bool) []*foundConfig {
 			if !ok {
 				pathsSeen[config.Path] = true
 				if prefetch {
-					// go config.Config()
-					// Scripts calls .Config()
-					go config.Scripts()
+					go config.Config()
 				}
 				uniqueConfigs = append(uniqueConfigs, config)
 			}
 		}
 	}
-	if useHistory {
-		data, err := json.Marshal(uniqueConfigs)
-		if err != nil {
-			logger.Debugf("unable to marshall history file with err %s", err)
+	sortByProximity(uniqueConfigs)
+	return uniqueConfigs
+}
+
+// Configs the directory change hook resolves from on every cd. Git isn't run and nothing is written, git configs
+// come from the discovery cache and history is only read.
+func LoadCachedConfigs() []*foundConfig {
+	allDiscovered := [][]*foundConfig{
+		cachedConfigPathsFromGit(),
+		configsPathsFromPwd(),
+		configPathsFromAncestors(),
+		configPathsFromSearchPath(),
+	}
+	if useConfigHistory() {
+		allDiscovered = append(allDiscovered, configPathsFromHistory())
+	}
+	return dedupeConfigs(allDiscovered, false)
+}
+
+func LoadConfigs(prefetch bool, useHistory bool) []*foundConfig {
+	allDiscovered := [][]*foundConfig{
+		configPathsFromGit(),
+		configsPathsFromPwd(),
+		configPathsFromAncestors(),
+		configPathsFromSearchPath(),
+	}
+	now := time.Now()
+	for _, discoveredConfigs := range allDiscovered {
+		for _, config := range discoveredConfigs {
+			config.LastSeen = now
 		}
-		os.MkdirAll(filepath.Dir(seenConfigsPath), 0700)
-		err = ioutil.WriteFile(seenConfigsPath, data, 0600)
+	}
+	if useHistory {
+		allDiscovered = append(allDiscovered, configPathsFromHistory())
+	}
+	uniqueConfigs := dedupeConfigs(allDiscovered, prefetch)
+	if useHistory {
+		err := writeHistory(uniqueConfigs)
 		if err != nil {
 			logger.Debugf("Unable to save to history file at %s with err %s", seenConfigsPath, err)
 		}
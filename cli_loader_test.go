@@ -0,0 +1,252 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Writes files, keyed by their path relative to a new temp dir, and returns the dir
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root, err := ioutil.TempDir("", "venvy-loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(root, name), content)
+	}
+	return root
+}
+
+func TestLoadConfigFileIncludes(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		// Module name to the file defining it, relative to the temp dir
+		wantModules  map[string]string
+		wantProjects []string
+		wantErr      string
+	}{
+		{
+			name: "relative to the including file",
+			files: map[string]string{
+				"venvy.toml":            "include = [\"shared/modules.toml\"]\n\n[[projects]]\nname = \"acme\"\nmodules = [\"py\"]\n",
+				"shared/modules.toml":   "include = [\"../more/modules.yaml\"]\n\n[[modules]]\nname = \"py\"\ntype = \"python\"\n",
+				"more/modules.yaml":     "modules:\n  - name: node\n    type: env\n",
+				"unrelated/venvy.toml":  "[[modules]]\nname = \"unused\"\ntype = \"env\"\n",
+				"shared/unrelated.toml": "[[modules]]\nname = \"unused\"\ntype = \"env\"\n",
+			},
+			wantModules:  map[string]string{"py": "shared/modules.toml", "node": "more/modules.yaml"},
+			wantProjects: []string{"acme"},
+		},
+		{
+			name: "including file wins",
+			files: map[string]string{
+				"venvy.toml": "include = [\"a.toml\", \"b.toml\"]\n\n[[modules]]\nname = \"py\"\ntype = \"python\"\n",
+				"a.toml":     "[[modules]]\nname = \"py\"\ntype = \"env\"\n\n[[modules]]\nname = \"node\"\ntype = \"env\"\n",
+				"b.toml":     "[[modules]]\nname = \"node\"\ntype = \"env\"\n\n[[projects]]\nname = \"acme\"\n",
+			},
+			wantModules:  map[string]string{"py": "venvy.toml", "node": "b.toml"},
+			wantProjects: []string{"acme"},
+		},
+		{
+			name: "same file twice",
+			files: map[string]string{
+				"venvy.toml": "include = [\"a.toml\", \"./a.toml\"]\n",
+				"a.toml":     "[[modules]]\nname = \"py\"\ntype = \"python\"\n",
+			},
+			wantModules: map[string]string{"py": "a.toml"},
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"venvy.toml": "include = [\"a.toml\"]\n",
+				"a.toml":     "include = [\"sub/b.toml\"]\n",
+				"sub/b.toml": "include = [\"../venvy.toml\"]\n",
+			},
+			wantErr: "sub/b.toml:1: unable to include ../venvy.toml: include cycle: venvy.toml -> a.toml -> sub/b.toml -> venvy.toml",
+		},
+		{
+			name:    "missing",
+			files:   map[string]string{"venvy.toml": "namespace = \"acme\"\ninclude = [\"missing.toml\"]\n"},
+			wantErr: "venvy.toml:2: unable to include missing.toml",
+		},
+		{
+			name: "error in an included file",
+			files: map[string]string{
+				"venvy.toml": "include = [\"a.toml\"]\n",
+				"a.toml":     "[[modules]]\nname = \n",
+			},
+			wantErr: "a.toml:2: unable to parse config",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeTestFiles(t, tc.files)
+			defer os.RemoveAll(root)
+			config, err := loadConfigFile(filepath.Join(root, "venvy.toml"), nil)
+			if tc.wantErr != "" {
+				if err == nil {
+					t.Fatalf("no error, expected %q", tc.wantErr)
+				}
+				// Paths read relative to the temp dir
+				if errText := strings.Replace(err.Error(), root+string(filepath.Separator), "", -1); !strings.HasPrefix(errText, tc.wantErr) {
+					t.Fatalf("got error %s, expected %q", errText, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			modules := map[string]string{}
+			for _, module := range config.Modules {
+				relPath, _ := filepath.Rel(root, module.SourcePath)
+				modules[module.Name] = relPath
+			}
+			if !reflect.DeepEqual(modules, tc.wantModules) {
+				t.Errorf("modules %v, expected %v", modules, tc.wantModules)
+			}
+			projects := []string{}
+			for _, project := range config.Projects {
+				projects = append(projects, project.Name)
+			}
+			if len(projects) > 0 || len(tc.wantProjects) > 0 {
+				if !reflect.DeepEqual(projects, tc.wantProjects) {
+					t.Errorf("projects %v, expected %v", projects, tc.wantProjects)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileErrorLines(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "json syntax",
+			file:    "venvy.json",
+			content: "{\n  \"modules\": [\n    {\"name\": \"py\",}\n  ]\n}\n",
+			wantErr: "venvy.json:3: unable to parse config",
+		},
+		{
+			name:    "json type",
+			file:    "venvy.json",
+			content: "{\n  \"projects\": [\n    {\n      \"name\": \"acme\",\n      \"modules\": \"py\"\n    }\n  ]\n}\n",
+			wantErr: "venvy.json:5: unable to unmarshal config",
+		},
+		{
+			name:    "yaml syntax",
+			file:    "venvy.yaml",
+			content: "projects:\n  - name: acme\n    modules: [py\n",
+			wantErr: "venvy.yaml:3: unable to parse config",
+		},
+		{
+			name:    "yaml validation",
+			file:    "venvy.yml",
+			content: "modules:\n  - name: py\n    type: python\n  - name: bad name\n    type: env\n",
+			wantErr: "venvy.yml:4: unable to validate config",
+		},
+		{
+			name:    "toml syntax",
+			file:    "venvy.toml",
+			content: "[[projects]]\nname = \"acme\"\nmodules = [\"py\"\n",
+			wantErr: "venvy.toml:3: unable to parse config",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeTestFiles(t, map[string]string{tc.file: tc.content})
+			defer os.RemoveAll(root)
+			_, err := loadConfigFile(filepath.Join(root, tc.file), nil)
+			if err == nil {
+				t.Fatalf("no error, expected %q", tc.wantErr)
+			}
+			if errText := strings.TrimPrefix(err.Error(), root+string(filepath.Separator)); !strings.HasPrefix(errText, tc.wantErr) {
+				t.Errorf("got error %s, expected %q", errText, tc.wantErr)
+			}
+		})
+	}
+}
+
+// Paths of the configs under root relative to it, configs outside the test's temp dir are left out
+func relativePaths(root string, found []*foundConfig) []string {
+	paths := []string{}
+	for _, config := range found {
+		if relPath, err := filepath.Rel(root, config.Path); err == nil && !strings.HasPrefix(relPath, "..") {
+			paths = append(paths, relPath)
+		}
+	}
+	return paths
+}
+
+func TestConfigPathsFromAncestorsAndSearchPath(t *testing.T) {
+	cases := []struct {
+		name          string
+		files         []string
+		cwd           string
+		searchPath    []string
+		wantAncestors []string
+		wantSearch    []string
+	}{
+		{
+			name:          "nearest ancestor first",
+			files:         []string{"venvy.toml", "a/venvy.toml", "a/b/c/venvy.toml", "a/b/other/venvy.toml"},
+			cwd:           "a/b/c",
+			wantAncestors: []string{"a/venvy.toml", "venvy.toml"},
+		},
+		{
+			name:          "every config file name",
+			files:         []string{"venvy.yaml", "a/venvy.json", "a/b/venvy.toml"},
+			cwd:           "a/b",
+			wantAncestors: []string{"venvy.yaml", "a/venvy.json"},
+		},
+		{
+			name:       "search path files and directories in order",
+			files:      []string{"envs/venvy.toml", "envs/venvy.yaml", "shared/tools.toml", "cwd/.keep"},
+			cwd:        "cwd",
+			searchPath: []string{"shared/tools.toml", "", "missing", "envs"},
+			wantSearch: []string{"shared/tools.toml", "envs/venvy.toml", "envs/venvy.yaml"},
+		},
+		{
+			name:       "search path directories aren't searched below",
+			files:      []string{"envs/sub/venvy.toml", "cwd/.keep"},
+			cwd:        "cwd",
+			searchPath: []string{"envs"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t, func(root string) {
+				for _, file := range tc.files {
+					writeTestFile(t, filepath.Join(root, file), "")
+				}
+				entries := []string{}
+				for _, entry := range tc.searchPath {
+					if entry != "" {
+						entry = filepath.Join(root, entry)
+					}
+					entries = append(entries, entry)
+				}
+				defer os.Setenv(searchPathEnvVar, os.Getenv(searchPathEnvVar))
+				os.Setenv(searchPathEnvVar, strings.Join(entries, string(os.PathListSeparator)))
+				if err := os.Chdir(filepath.Join(root, tc.cwd)); err != nil {
+					t.Fatal(err)
+				}
+				if got := relativePaths(root, configPathsFromAncestors()); !reflect.DeepEqual(got, append([]string{}, tc.wantAncestors...)) {
+					t.Errorf("found %v in ancestors, expected %v", got, tc.wantAncestors)
+				}
+				if got := relativePaths(root, configPathsFromSearchPath()); !reflect.DeepEqual(got, append([]string{}, tc.wantSearch...)) {
+					t.Errorf("found %v in the search path, expected %v", got, tc.wantSearch)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pnegahdar/venvy/manager"
+	logger "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Prefixes every complete line written to it, lines of concurrent writers sharing the lock never interleave
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	lock   *sync.Mutex
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		end := bytes.IndexByte(w.buf, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		w.writeLine(w.buf[:end+1])
+		w.buf = w.buf[end+1:]
+	}
+}
+
+// Writes what is left of an unterminated last line
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+}
+
+type runResult struct {
+	project  string
+	status   string
+	failed   bool
+	duration time.Duration
+}
+
+// A project's exec script running in its own process group
+type projectRun struct {
+	name       string
+	manager    *venvy.ProjectManager
+	scriptPath string
+	cmd        *exec.Cmd
+	started    bool
+}
+
+var runPrefixColors = []color.Attribute{color.FgCyan, color.FgMagenta, color.FgYellow, color.FgBlue, color.FgGreen}
+
+// Started under the lock the signal forwarding holds so a signal arriving meanwhile isn't missed, once one arrived
+// projects that haven't started are skipped
+func (r *projectRun) run(prefix string, lock *sync.Mutex, interrupted *bool) *runResult {
+	stdout := &prefixWriter{prefix: prefix, out: os.Stdout, lock: lock}
+	stderr := &prefixWriter{prefix: prefix, out: os.Stderr, lock: lock}
+	r.cmd.Stdout = stdout
+	r.cmd.Stderr = stderr
+	start := time.Now()
+	lock.Lock()
+	if *interrupted {
+		lock.Unlock()
+		return &runResult{project: r.name, status: "skipped", failed: true}
+	}
+	err := r.cmd.Start()
+	r.started = err == nil
+	lock.Unlock()
+	if err == nil {
+		err = r.cmd.Wait()
+	}
+	stdout.Flush()
+	stderr.Flush()
+	result := &runResult{project: r.name, status: "ok", duration: time.Since(start)}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		result.failed = true
+		result.status = fmt.Sprintf("exit %d", exitErr.ExitCode())
+		if exitErr.ExitCode() < 0 {
+			result.status = exitErr.ProcessState.String()
+		}
+	} else if err != nil {
+		result.failed = true
+		result.status = err.Error()
+	}
+	return result
+}
+
+// Runs every project with at most parallel at a time, results are in the order of the projects
+func runProjects(runs []*projectRun, parallel int) []*runResult {
+	width := 0
+	for _, r := range runs {
+		if len(r.name) > width {
+			width = len(r.name)
+		}
+	}
+	var lock sync.Mutex
+	interrupted := false
+	signalC := make(chan os.Signal, 1)
+	signal.Notify(signalC, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(signalC)
+	go func() {
+		for sig := range signalC {
+			lock.Lock()
+			interrupted = true
+			for _, r := range runs {
+				if r.started {
+					logger.Debugf("Forwarding signal %s to %s", sig, r.name)
+					forwardSignal(r.cmd, sig)
+				}
+			}
+			lock.Unlock()
+		}
+	}()
+
+	// Projects start in the order they were given
+	results := make([]*runResult, len(runs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < parallel; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				prefix := color.New(runPrefixColors[i%len(runPrefixColors)]).Sprintf("%-*s | ", width, runs[i].name)
+				results[i] = runs[i].run(prefix, &lock, &interrupted)
+			}
+		}()
+	}
+	for i := range runs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+func printRunSummary(results []*runResult) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PROJECT\tSTATUS\tDURATION")
+	for _, result := range results {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", result.project, result.status, result.duration.Round(10*time.Millisecond))
+	}
+	table.Flush()
+}
+
+// Finds a project by its command name or its namespace:project name
+func findLoadedProject(name string) *venvy.ProjectManager {
+	for _, projectManager := range loadedProjects {
+		if commandName(projectManager) == name || projectCommands[projectManager].Qualified == name {
+			return projectManager
+		}
+	}
+	return nil
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run -p project [-p project...] -- command",
+	Short: "Run a command in the environment of several projects concurrently",
+	Run: func(cmd *cobra.Command, args []string) {
+		projectNames, err := cmd.Flags().GetStringArray("project")
+		errExit(err)
+		parallel, err := cmd.Flags().GetInt("parallel")
+		errExit(err)
+		temp, err := cmd.Flags().GetBool("temp")
+		errExit(err)
+		if len(projectNames) == 0 || len(args) == 0 {
+			errExit(fmt.Errorf("usage: %s run -p project [-p project...] -- command", venvy.ProjectName))
+		}
+		if parallel < 1 {
+			parallel = len(projectNames)
+		}
+
+		// Every script is built before anything runs so config errors don't leave half the matrix running
+		runs := []*projectRun{}
+		cleanup := func() {
+			for _, r := range runs {
+				os.Remove(r.scriptPath)
+			}
+		}
+		// By project so a name and its namespace:project name count as the same
+		seen := map[*venvy.ProjectManager]string{}
+		for _, name := range projectNames {
+			projectManager := findLoadedProject(name)
+			if projectManager == nil {
+				err = fmt.Errorf("project %s not found", name)
+			} else if previous, ok := seen[projectManager]; ok && previous == name {
+				err = fmt.Errorf("project %s is given more than once", name)
+			} else if ok {
+				err = fmt.Errorf("projects %s and %s are the same project", previous, name)
+			} else if temp {
+				err = useTempDir(projectManager)
+			}
+			if err != nil {
+				cleanup()
+				errExit(err)
+			}
+			seen[projectManager] = name
+			addBuiltinModules(projectManager)
+			scriptPath, err := writeExecScript(projectManager, args)
+			if err != nil {
+				cleanup()
+				errExit(err)
+			}
+			execCmd := exec.Command("sh", scriptPath)
+			setProcessGroup(execCmd)
+			runs = append(runs, &projectRun{name: name, manager: projectManager, scriptPath: scriptPath, cmd: execCmd})
+		}
+		logger.Debugf("Running %s in %s", strings.Join(args, " "), strings.Join(projectNames, ", "))
+
+		results := runProjects(runs, parallel)
+		cleanup()
+		fmt.Println()
+		printRunSummary(results)
+		for _, result := range results {
+			if result.failed {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	runCmd.Flags().StringArrayP("project", "p", nil, "project to run the command in, repeat for more")
+	runCmd.Flags().Int("parallel", runtime.NumCPU(), "how many projects run at once, 0 runs all of them")
+	runCmd.Flags().Bool("temp", false, "create a temp data dir for each project")
+	// Everything from the first arg on is the command to run, flags included
+	runCmd.Flags().SetInterspersed(false)
+}
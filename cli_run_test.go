@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRunProjects(t *testing.T) {
+	// Fails in two as TWO is only set there
+	command := []string{"--", "sh", "-c", `echo "out ${ONE-}${TWO-}"; echo "err" >&2; [ -z "${TWO-}" ]`}
+	cases := []struct {
+		name     string
+		args     []string
+		want     []string
+		exitCode int
+	}{
+		{
+			name:     "one failing",
+			args:     append([]string{"run", "-p", "one", "-p", "two"}, command...),
+			want:     []string{`(?m)^one \| out 1$`, `(?m)^two \| out 2$`, `(?m)^PROJECT +STATUS +DURATION$`, `(?m)^one +ok +\S+$`, `(?m)^two +exit 1 +\S+$`},
+			exitCode: 1,
+		},
+		{
+			name:     "one at a time in order",
+			args:     append([]string{"run", "--parallel", "1", "-p", "two", "-p", "one"}, command...),
+			want:     []string{`(?s)two \| out 2.*one \| out 1.*two +exit 1.*one +ok`},
+			exitCode: 1,
+		},
+		{
+			name: "all passing",
+			args: append([]string{"run", "-p", "one"}, command...),
+			want: []string{`(?m)^one \| out 1$`, `(?m)^one +ok +\S+$`},
+		},
+		{
+			name:     "unknown project runs nothing",
+			args:     append([]string{"run", "-p", "one", "-p", "nope"}, command...),
+			exitCode: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t, func(root string) {
+				writeTestFile(t, filepath.Join(root, defaultFileName), stackTestConfig)
+				out, exitCode := runMain(t, root, []string{"HOME=" + root, disableHistoryEnvVar + "=1"}, tc.args...)
+				if exitCode != tc.exitCode {
+					t.Errorf("exited with %d, expected %d:\n%s", exitCode, tc.exitCode, out)
+				}
+				for _, want := range tc.want {
+					if !regexp.MustCompile(want).MatchString(out) {
+						t.Errorf("output doesn't match %s:\n%s", want, out)
+					}
+				}
+				if len(tc.want) == 0 && out != "" {
+					t.Errorf("expected no output, got:\n%s", out)
+				}
+				if strings.Contains(out, "err") {
+					t.Errorf("stderr of the projects is in stdout:\n%s", out)
+				}
+			})
+		})
+	}
+}
+
+// A signal to venvy reaches the running project and the ones not started yet are skipped
+func TestRunForwardsSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no signals on windows")
+	}
+	inTempDir(t, func(root string) {
+		writeTestFile(t, filepath.Join(root, defaultFileName), stackTestConfig)
+		cmd := exec.Command(os.Args[0], "-test.run=^TestMainHelperProcess$", "--",
+			"run", "--parallel", "1", "-p", "one", "-p", "two", "--",
+			"sh", "-c", `trap 'echo got TERM; exit 3' TERM; echo started; while :; do sleep 0.1; done`)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(), "VENVY_TEST_MAIN=1", "HOME="+root, disableHistoryEnvVar+"=1")
+		cmd.Stderr = ioutil.Discard
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		out := ""
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			out += scanner.Text() + "\n"
+			if strings.HasSuffix(scanner.Text(), "| started") {
+				cmd.Process.Signal(syscall.SIGTERM)
+			}
+		}
+		err = cmd.Wait()
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			t.Errorf("exited with %v, expected status 1:\n%s", err, out)
+		}
+		for _, want := range []string{`(?m)^one \| got TERM$`, `(?m)^one +exit 3 `, `(?m)^two +skipped `} {
+			if !regexp.MustCompile(want).MatchString(out) {
+				t.Errorf("output doesn't match %s:\n%s", want, out)
+			}
+		}
+		if strings.Contains(out, "two | started") {
+			t.Errorf("two ran after the signal:\n%s", out)
+		}
+	})
+}
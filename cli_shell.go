@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/pnegahdar/venvy/shell"
+	"github.com/pnegahdar/venvy/util"
+	logger "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var shellEnvVar = fmt.Sprintf("%s_SHELL", strings.ToUpper(venvy.ProjectName))
+
+var knownShells = []string{shell.Bash, shell.Zsh, shell.Posix, shell.Fish}
+
+const fishEvalTmpl = `
+if not functions -q {{ .ProjectName }}
+	set -g __{{ .ProjectName }}_original_cmd (command -s {{ .ProjectName }})
+	function {{ .ProjectName }}
+		set -l activate_f (mktemp)
+		set -l deactivate_f (mktemp)
+		env {{ .ShellEnvVar }}=fish {{ .ActivateFileEnvVar }}=$activate_f {{ .DeactivateFileEnvVar }}=$deactivate_f $__{{ .ProjectName }}_original_cmd $argv
+		or return $status
+		if test -s $activate_f
+			if not string match -q -- '{{ .StackMarker }}' (head -n 1 $activate_f)
+				devenv --all
+			end
+			env {{ .ShellEnvVar }}=fish {{ .ActivateFileEnvVar }}=$activate_f {{ .DeactivateFileEnvVar }}=$deactivate_f $__{{ .ProjectName }}_original_cmd $argv
+			or return $status
+			set -gx DEACTIVATE_F (string join : $deactivate_f $DEACTIVATE_F)
+			source $activate_f
+			or return $status
+		end
+		rm -f $activate_f
+	end
+	function devenv
+		if test "$argv[1]" = --all
+			while test -n "$DEACTIVATE_F"
+				devenv
+				or return $status
+			end
+			return 0
+		end
+		set -l stack (string split -- : "$DEACTIVATE_F")
+		if test -n "$stack[1]"
+			if test -s $stack[1]
+				source $stack[1]
+				or return $status
+			end
+			rm -f $stack[1]
+		end
+		if test (count $stack) -gt 1
+			set -gx DEACTIVATE_F (string join : $stack[2..-1])
+		else
+			set -e DEACTIVATE_F
+		end
+	end
+	if functions -q fish_prompt; and not functions -q __{{ .ProjectName }}_fish_prompt
+		functions -c fish_prompt __{{ .ProjectName }}_fish_prompt
+		function fish_prompt
+			if set -q {{ .ActiveStackEnvVar }}
+				set_color cyan; printf '['; set_color blue; printf '{{ .ProjectName }}'; set_color green; printf ':'
+				set_color magenta; printf '%s' ${{ .ActiveStackEnvVar }}; set_color cyan; printf '] '; set_color normal
+			end
+			__{{ .ProjectName }}_fish_prompt
+		end
+	end
+	function __{{ .ProjectName }}_auto_activate --on-variable PWD
+		set -l target ($__{{ .ProjectName }}_original_cmd __auto-resolve $PWD 2>/dev/null)
+		if test -n "$target"
+			if not set -q {{ .ActiveProjectEnvVar }}
+				{{ .ProjectName }} $target --auto
+			else if set -q {{ .AutoActivatedEnvVar }}; and test "$target" != "${{ .AutoActivatedEnvVar }}"
+				devenv; and {{ .ProjectName }} $target --auto
+			end
+		else if set -q {{ .AutoActivatedEnvVar }}
+			devenv
+		end
+	end
+	__{{ .ProjectName }}_auto_activate
+end
+`
+
+// The shell that invoked us through the shell-init wrapper, posix unless told otherwise
+func invokingShell() string {
+	if os.Getenv(shellEnvVar) == shell.Fish {
+		return shell.Fish
+	}
+	return shell.Posix
+}
+
+func shellFromName(name string) string {
+	name = strings.TrimPrefix(filepath.Base(strings.TrimSpace(name)), "-")
+	for _, known := range knownShells {
+		if name == known {
+			return known
+		}
+	}
+	return ""
+}
+
+// Prefer the parent process (the shell running the eval) over $SHELL which is only the login shell
+func detectShell() string {
+	output, err := exec.Command("ps", "-p", strconv.Itoa(os.Getppid()), "-o", "comm=").Output()
+	if err == nil {
+		if shell := shellFromName(string(output)); shell != "" {
+			return shell
+		}
+	}
+	if shellName := shellFromName(os.Getenv("SHELL")); shellName != "" {
+		return shellName
+	}
+	return shell.Posix
+}
+
+func fishEvalScript() (string, error) {
+	return util.StringTemplate("fishEvalTmpl", fishEvalTmpl, struct {
+		ProjectName          string
+		ShellEnvVar          string
+		ActivateFileEnvVar   string
+		DeactivateFileEnvVar string
+		ActiveProjectEnvVar  string
+		AutoActivatedEnvVar  string
+		ActiveStackEnvVar    string
+		StackMarker          string
+	}{
+		ProjectName:          venvy.ProjectName,
+		ShellEnvVar:          shellEnvVar,
+		ActivateFileEnvVar:   activateFileEnvVar,
+		DeactivateFileEnvVar: deactivateFileEnvVar,
+		ActiveProjectEnvVar:  activeProjectEnvVar,
+		AutoActivatedEnvVar:  autoActivatedEnvVar,
+		ActiveStackEnvVar:    activeStackEnvVar,
+		StackMarker:          stackMarker,
+	})
+}
+
+// An auto_activate project and the namespace:project name the hook activates and compares it by, which unlike the
+// command name doesn't depend on the cwd
+type autoProject struct {
+	rootDir   string
+	qualified string
+}
+
+// The auto_activate projects of the configs found without running git or writing anything
+func cachedAutoProjects() []*autoProject {
+	loadedConfigs, err := loadConfigManagers(LoadCachedConfigs())
+	if err != nil {
+		logger.Debugf("unable to load configs for auto activation with err %s", err)
+		return nil
+	}
+	projects := []*autoProject{}
+	for _, loaded := range loadedConfigs {
+		namespace := configNamespace(loaded.found)
+		for _, project := range loaded.found.Config().Projects {
+			resolved, err := loaded.manager.ResolvedProject(project.Name)
+			if err != nil || !resolved.AutoActivate {
+				continue
+			}
+			projects = append(projects, &autoProject{rootDir: loaded.manager.ProjectRootDir(resolved), qualified: qualifiedName(namespace, project.Name)})
+		}
+	}
+	return projects
+}
+
+// Deepest auto_activate project whose root contains dir
+func resolveAutoProject(dir string, projects []*autoProject) *autoProject {
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		resolvedDir = dir
+	}
+	var best *autoProject
+	bestDepth := -1
+	for _, project := range projects {
+		root := project.rootDir
+		resolvedRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			resolvedRoot = root
+		}
+		if !util.PathContains(root, dir) && !util.PathContains(resolvedRoot, resolvedDir) {
+			continue
+		}
+		depth := strings.Count(filepath.Clean(root), string(filepath.Separator))
+		if depth > bestDepth {
+			best = project
+			bestDepth = depth
+		}
+	}
+	return best
+}
+
+var autoResolveCmd = &cobra.Command{
+	Use:    "__auto-resolve [dir]",
+	Short:  "Print the auto_activate project for a directory",
+	Hidden: true,
+	Args:   cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := os.Getwd()
+		errExit(err)
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		if project := resolveAutoProject(dir, cachedAutoProjects()); project != nil {
+			fmt.Println(project.qualified)
+		}
+	},
+}
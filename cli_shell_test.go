@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pnegahdar/venvy/manager"
+)
+
+// Sources the shell-init output in bash with venvy on the PATH replaced by stub, then runs script with env added to
+// the environment
+func runWithShellInit(t *testing.T, stub string, script string, env ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	binDir, err := ioutil.TempDir("", "venvy-shell-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binDir)
+	err = ioutil.WriteFile(filepath.Join(binDir, venvy.ProjectName), []byte("#!/bin/sh\n"+stub), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initScript, err := evalScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", initScript+"\n"+script)
+	cmd.Dir = binDir
+	cmd.Env = append(append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH")), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash: %s %s", err, out)
+	}
+	return string(out)
+}
+
+func TestShellInitPassesArgv(t *testing.T) {
+	stub := `for arg in "$@"; do printf '<%s>\n' "$arg"; done`
+	cases := []struct {
+		name string
+		args string
+		want []string
+	}{
+		{"plain", `acme`, []string{"acme"}},
+		{"spaces", `acme -- echo "a  b" 'c d'`, []string{"acme", "--", "echo", "a  b", "c d"}},
+		{"globs", `acme -- ls '*' "[a-z]*" '?'`, []string{"acme", "--", "ls", "*", "[a-z]*", "?"}},
+		{"empty", `acme -- printf ''`, []string{"acme", "--", "printf", ""}},
+		{"expansions", `acme -- echo '$HOME' '$(id)' '\n'`, []string{"acme", "--", "echo", "$HOME", "$(id)", `\n`}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A file a glob would expand to
+			out := runWithShellInit(t, stub, "touch zz; "+venvy.ProjectName+" "+tc.args)
+			want := ""
+			for _, arg := range tc.want {
+				want += "<" + arg + ">\n"
+			}
+			if out != want {
+				t.Errorf("argv arrived as\n%s\nexpected\n%s", out, want)
+			}
+		})
+	}
+}
+
+func TestShellInitPropagatesExitStatus(t *testing.T) {
+	out := runWithShellInit(t, "exit 3", venvy.ProjectName+" acme; echo status=$?")
+	if strings.TrimSpace(out) != "status=3" {
+		t.Errorf("got %q, expected status=3", out)
+	}
+}
+
+func TestAutoResolveWritesNothing(t *testing.T) {
+	config := `namespace = "acme"
+
+[[projects]]
+name = "app"
+auto_activate = true
+
+[[projects]]
+name = "api"
+root = "services/api"
+auto_activate = true
+
+[[projects]]
+name = "manual"
+root = "services/manual"
+`
+	cases := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{name: "config dir", dir: ".", want: "acme:app"},
+		{name: "deepest root", dir: "services/api/cmd", want: "acme:api"},
+		{name: "not auto activated", dir: "services/manual", want: "acme:app"},
+		{name: "outside every root", dir: "..", want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t, func(root string) {
+				projectDir := filepath.Join(root, "project")
+				writeTestFile(t, filepath.Join(projectDir, defaultFileName), config)
+				os.MkdirAll(filepath.Join(projectDir, "services", "api", "cmd"), 0700)
+				os.MkdirAll(filepath.Join(projectDir, "services", "manual"), 0700)
+				homeDir := filepath.Join(root, "home")
+				env := []string{"HOME=" + homeDir, "XDG_CONFIG_HOME=" + filepath.Join(homeDir, ".config"), disableHistoryEnvVar + "=1"}
+				out, exitCode := runMain(t, projectDir, env, "__auto-resolve", filepath.Join(projectDir, tc.dir))
+				if exitCode != 0 || strings.TrimSpace(out) != tc.want {
+					t.Errorf("resolved to %q (exit %d), expected %q", out, exitCode, tc.want)
+				}
+				if _, err := os.Stat(dotDir(projectDir)); !os.IsNotExist(err) {
+					t.Errorf("%s was created", dotDir(projectDir))
+				}
+			})
+		})
+	}
+}
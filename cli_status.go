@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/spf13/cobra"
+)
+
+type moduleStatus struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+type activeStatus struct {
+	Active      bool            `json:"active"`
+	Project     string          `json:"project,omitempty"`
+	Stack       []string        `json:"stack,omitempty"`
+	ConfigPath  string          `json:"config_path,omitempty"`
+	StorageDir  string          `json:"storage_dir,omitempty"`
+	ActivatedAt string          `json:"activated_at,omitempty"`
+	Modules     []*moduleStatus `json:"modules,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// Finds the project manager for the recorded activation, preferring already discovered configs
+func activeProjectManager(status *activeStatus) (*venvy.ProjectManager, error) {
+	foundConfigs := LoadConfigs(false, useConfigHistory())
+	discovered := false
+	for _, configF := range foundConfigs {
+		discovered = discovered || configF.Path == status.ConfigPath
+	}
+	if !discovered {
+		foundConfigs = append(foundConfigs, &foundConfig{Path: status.ConfigPath, StorageDir: dotDir(filepath.Dir(status.ConfigPath))})
+	}
+	loadedConfigs, err := loadConfigManagers(foundConfigs)
+	if err != nil {
+		return nil, err
+	}
+	var configManager *venvy.ConfigManager
+	for _, loaded := range loadedConfigs {
+		if loaded.found.Path == status.ConfigPath {
+			configManager = loaded.manager
+		}
+	}
+	if configManager == nil {
+		return nil, fmt.Errorf("unable to load config %s", status.ConfigPath)
+	}
+	projectManager, err := configManager.ProjectManager(bareProjectName(status.Project))
+	if err != nil {
+		return nil, err
+	}
+	// Activated with --temp or similar
+	if status.StorageDir != "" && status.StorageDir != projectManager.StoragePath() {
+		err = projectManager.ChDir(status.StorageDir)
+	}
+	return projectManager, err
+}
+
+func loadActiveStatus() *activeStatus {
+	status := &activeStatus{
+		Project:     os.Getenv(activeProjectEnvVar),
+		ConfigPath:  os.Getenv(activeConfigEnvVar),
+		StorageDir:  os.Getenv(activeStorageEnvVar),
+		ActivatedAt: os.Getenv(activatedAtEnvVar),
+	}
+	status.Active = status.Project != ""
+	if !status.Active {
+		return status
+	}
+	if stackValue := os.Getenv(activeStackEnvVar); stackValue != "" {
+		status.Stack = strings.Split(stackValue, ",")
+	}
+	activeModules := []string{}
+	if modulesValue := os.Getenv(activeModulesEnvVar); modulesValue != "" {
+		activeModules = strings.Split(modulesValue, ",")
+	}
+	details := map[string]*venvy.NamedModuler{}
+	projectManager, err := activeProjectManager(status)
+	if err == nil {
+		addBuiltinModules(projectManager)
+		var namedModulers []*venvy.NamedModuler
+		namedModulers, err = projectManager.Modulers()
+		for _, namedModuler := range namedModulers {
+			details[namedModuler.Name] = namedModuler
+		}
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	for _, moduleName := range activeModules {
+		modStatus := &moduleStatus{Name: moduleName}
+		namedModuler, ok := details[moduleName]
+		if ok {
+			modStatus.Type = namedModuler.Type
+			if describer, ok := namedModuler.Module.(venvy.ModuleDescriber); ok {
+				modStatus.Details = describer.Describe()
+			}
+		} else if err == nil {
+			modStatus.Error = "module no longer in the project config"
+		}
+		status.Modules = append(status.Modules, modStatus)
+	}
+	return status
+}
+
+func printStatus(status *activeStatus) {
+	if !status.Active {
+		fmt.Println("No project active")
+		return
+	}
+	activatedAt := status.ActivatedAt
+	if parsed, err := time.Parse(time.RFC3339, status.ActivatedAt); err == nil {
+		activatedAt = fmt.Sprintf("%s (%s ago)", status.ActivatedAt, time.Since(parsed).Round(time.Second))
+	}
+	fmt.Printf("project:   %s\n", status.Project)
+	if len(status.Stack) > 1 {
+		fmt.Printf("stack:     %s\n", strings.Join(status.Stack, " > "))
+	}
+	fmt.Printf("config:    %s\n", status.ConfigPath)
+	fmt.Printf("storage:   %s\n", status.StorageDir)
+	fmt.Printf("activated: %s\n", activatedAt)
+	if status.Error != "" {
+		fmt.Printf("error:     %s\n", status.Error)
+	}
+	fmt.Println("modules:")
+	for _, module := range status.Modules {
+		fmt.Printf("  %s (%s)\n", module.Name, module.Type)
+		if module.Error != "" {
+			fmt.Printf("    error: %s\n", module.Error)
+		}
+		keys := []string{}
+		for key := range module.Details {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if module.Details[key] != "" {
+				fmt.Printf("    %s: %s\n", key, module.Details[key])
+			}
+		}
+	}
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the project active in this shell",
+	Run: func(cmd *cobra.Command, args []string) {
+		asJson, err := cmd.Flags().GetBool("json")
+		errExit(err)
+		status := loadActiveStatus()
+		if asJson {
+			data, err := json.MarshalIndent(status, "", "  ")
+			errExit(err)
+			fmt.Println(string(data))
+			return
+		}
+		printStatus(status)
+	},
+}
+
+func init() {
+	statusCmd.Flags().Bool("json", false, "print the status as json")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pnegahdar/venvy/shell"
+)
+
+func TestStatusReadsActivationMetadata(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+		want   activeStatus
+	}{
+		{
+			name:   "nothing active",
+			script: "venvy status --json",
+			want:   activeStatus{},
+		},
+		{
+			name:   "active",
+			script: "venvy one; venvy status --json",
+			want: activeStatus{
+				Active:  true,
+				Project: "one",
+				Stack:   []string{"one"},
+				Modules: []*moduleStatus{{Name: "ps1_builtin", Type: "ps1"}, {Name: "jump_builtin", Type: "jump"}, {Name: "one_env", Type: "env"}},
+			},
+		},
+		{
+			name:   "stacked",
+			script: "venvy one; venvy two --stack; venvy status --json",
+			want: activeStatus{
+				Active:  true,
+				Project: "two",
+				Stack:   []string{"one", "two"},
+				Modules: []*moduleStatus{{Name: "ps1_builtin", Type: "ps1"}, {Name: "jump_builtin", Type: "jump"}, {Name: "two_env", Type: "env"}},
+			},
+		},
+		{
+			name:   "module dropped from the config since",
+			script: "venvy one; sed -i.bak 's/\"one_env\"]/]/' venvy.toml; venvy status --json",
+			want: activeStatus{
+				Active:  true,
+				Project: "one",
+				Stack:   []string{"one"},
+				Modules: []*moduleStatus{
+					{Name: "ps1_builtin", Type: "ps1"},
+					{Name: "jump_builtin", Type: "jump"},
+					{Name: "one_env", Error: "module no longer in the project config"},
+				},
+			},
+		},
+		{
+			name:   "deactivated",
+			script: "venvy one; devenv; venvy status --json",
+			want:   activeStatus{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t, func(root string) {
+				writeTestFile(t, filepath.Join(root, defaultFileName), stackTestConfig)
+				out := runWithShellInit(t, venvyStub(), "cd "+shell.Quote(root)+"; "+tc.script, "HOME="+root)
+				got := activeStatus{}
+				if err := json.Unmarshal([]byte(out), &got); err != nil {
+					t.Fatalf("%s: %s", err, out)
+				}
+				if got.Active {
+					if got.ConfigPath != filepath.Join(root, defaultFileName) {
+						t.Errorf("config %s, expected %s", got.ConfigPath, filepath.Join(root, defaultFileName))
+					}
+					if got.StorageDir != filepath.Join(dotDir(root), got.Project) {
+						t.Errorf("storage %s, expected %s", got.StorageDir, filepath.Join(dotDir(root), got.Project))
+					}
+					if got.ActivatedAt == "" {
+						t.Error("no activation time")
+					}
+				}
+				got.ConfigPath, got.StorageDir, got.ActivatedAt = "", "", ""
+				for _, module := range got.Modules {
+					module.Details = nil
+				}
+				if !reflect.DeepEqual(got, tc.want) {
+					gotJson, _ := json.Marshal(got)
+					wantJson, _ := json.Marshal(tc.want)
+					t.Errorf("status\n%s\nexpected\n%s", gotJson, wantJson)
+				}
+			})
+		})
+	}
+}
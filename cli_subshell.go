@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/pnegahdar/venvy/shell"
+	logger "github.com/sirupsen/logrus"
+)
+
+// The shell to spawn and the renderer its activation uses, shells we don't know are treated as posix shells reading $ENV
+func subshellCommand() (path string, name string) {
+	path = os.Getenv("SHELL")
+	if path == "" {
+		path = "/bin/sh"
+	}
+	base := filepath.Base(path)
+	switch {
+	case strings.HasSuffix(base, shell.Bash):
+		return path, shell.Bash
+	case base == shell.Zsh:
+		return path, shell.Zsh
+	case base == shell.Fish:
+		return path, shell.Fish
+	}
+	return path, shell.Posix
+}
+
+// Posix function deactivating the subshell on exit, skipped if `devenv` already did
+func posixExitHook(deactivatePath string) string {
+	quoted := shell.Quote(deactivatePath)
+	return fmt.Sprintf("_%s_subshell_exit() { if [ -s %s ]; then . %s; fi; }\n", venvy.ProjectName, quoted, quoted)
+}
+
+// Writes the startup files of the subshell into dir, returning the extra args and env the shell is started with
+func subshellStartup(shellName string, dir string, activatePath string, deactivatePath string) (args []string, env []string, err error) {
+	hookName := fmt.Sprintf("_%s_subshell_exit", venvy.ProjectName)
+	switch shellName {
+	case shell.Bash:
+		rc := "if [ -f ~/.bashrc ]; then . ~/.bashrc; fi\n" +
+			fmt.Sprintf(". %s\n", shell.Quote(activatePath)) +
+			posixExitHook(deactivatePath) +
+			fmt.Sprintf("trap %s EXIT\n", hookName)
+		rcPath := filepath.Join(dir, "bashrc")
+		return []string{"--rcfile", rcPath, "-i"}, nil, ioutil.WriteFile(rcPath, []byte(rc), 0600)
+	case shell.Zsh:
+		// zsh reads its startup files from ZDOTDIR, each of ours sources the user's and the last one hands ZDOTDIR back
+		userDir, userDirSet := os.LookupEnv("ZDOTDIR")
+		if !userDirSet {
+			userDir = os.Getenv("HOME")
+		}
+		restore := fmt.Sprintf("ZDOTDIR=%s\n", shell.Quote(userDir))
+		sourceUser := func(name string) string {
+			return fmt.Sprintf("if [ -f \"$ZDOTDIR/%s\" ]; then . \"$ZDOTDIR/%s\"; fi\n", name, name)
+		}
+		files := map[string]string{}
+		for _, name := range []string{".zshenv", ".zprofile"} {
+			files[name] = restore + sourceUser(name) + fmt.Sprintf("ZDOTDIR=%s\n", shell.Quote(dir))
+		}
+		files[".zshrc"] = restore + sourceUser(".zshrc") +
+			fmt.Sprintf(". %s\n", shell.Quote(activatePath)) +
+			posixExitHook(deactivatePath) +
+			fmt.Sprintf("autoload -Uz add-zsh-hook && add-zsh-hook zshexit %s\n", hookName)
+		if !userDirSet {
+			files[".zshrc"] += "unset ZDOTDIR\n"
+		}
+		for name, contents := range files {
+			err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return []string{"-i"}, []string{"ZDOTDIR=" + dir}, nil
+	case shell.Fish:
+		// Runs after config.fish
+		initCommand := fmt.Sprintf("source %s; function %s --on-event fish_exit; if test -s %s; source %s; end; end",
+			shell.FishQuote(activatePath), hookName, shell.FishQuote(deactivatePath), shell.FishQuote(deactivatePath))
+		return []string{"--init-command", initCommand, "-i"}, nil, nil
+	}
+	// Interactive posix shells source the file named by ENV, shells started from the subshell get the user's back
+	rc := "unset ENV\n"
+	if userEnv, ok := os.LookupEnv("ENV"); ok {
+		rc = fmt.Sprintf("export ENV=%s\n", shell.Quote(userEnv))
+		rc += "if [ -f \"$ENV\" ]; then . \"$ENV\"; fi\n"
+	}
+	rc += fmt.Sprintf(". %s\n", shell.Quote(activatePath)) +
+		posixExitHook(deactivatePath) +
+		fmt.Sprintf("trap %s EXIT\n", hookName)
+	rcPath := filepath.Join(dir, "shrc")
+	return []string{"-i"}, []string{"ENV=" + rcPath}, ioutil.WriteFile(rcPath, []byte(rc), 0600)
+}
+
+// The subshell inherits the environment of this one, so the activation is layered like --stack
+func issueSubshell(manager *venvy.ProjectManager, shellArgs []string) {
+	shellPath, shellName := subshellCommand()
+	renderShell := shell.Posix
+	if shellName == shell.Fish {
+		renderShell = shell.Fish
+	}
+	if dryRun {
+		issueActivate(manager, renderShell, "", "")
+		return
+	}
+	dir, err := ioutil.TempDir("", venvy.ProjectName)
+	errExit(err)
+	defer os.RemoveAll(dir)
+	activatePath := filepath.Join(dir, "activate")
+	deactivatePath := filepath.Join(dir, "deactivate")
+	issueActivate(manager, renderShell, activatePath, deactivatePath)
+	startupArgs, startupEnv, err := subshellStartup(shellName, dir, activatePath, deactivatePath)
+	errExit(err)
+
+	// A devenv from shell-init inside the subshell only sees its own activation. The files and shell the wrapper
+	// told us about belong to the parent shell, a venvy run in the subshell without a wrapper mustn't write to them.
+	dropped := []string{"DEACTIVATE_F", activateFileEnvVar, deactivateFileEnvVar, shellEnvVar}
+	env := []string{}
+	for _, pair := range os.Environ() {
+		keep := true
+		for _, name := range dropped {
+			keep = keep && !strings.HasPrefix(pair, name+"=")
+		}
+		if keep {
+			env = append(env, pair)
+		}
+	}
+	env = append(env, startupEnv...)
+	env = append(env, "DEACTIVATE_F="+deactivatePath)
+
+	logger.Debugf("Starting %s subshell %s with args %s", shellName, shellPath, strings.Join(startupArgs, " "))
+	subshell := exec.Command(shellPath, append(startupArgs, shellArgs...)...)
+	subshell.Env = env
+	subshell.Stdin = os.Stdin
+	subshell.Stdout = os.Stdout
+	subshell.Stderr = os.Stderr
+	// Terminal signals reach us too, the shell decides what to do with them
+	signalC := make(chan os.Signal, 1)
+	signal.Notify(signalC, syscall.SIGINT, syscall.SIGQUIT)
+	defer signal.Stop(signalC)
+	err = subshell.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.RemoveAll(dir)
+		os.Exit(exitErr.ExitCode())
+	}
+	errExit(err)
+}
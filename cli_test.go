@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/pnegahdar/venvy/shell"
+	"github.com/pnegahdar/venvy/util"
+)
+
+// Not a test, runs main with the args after -- when started through venvyStub
+func TestMainHelperProcess(t *testing.T) {
+	if os.Getenv("VENVY_TEST_MAIN") != "1" {
+		return
+	}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{venvy.ProjectName}, os.Args[i+1:]...)
+			break
+		}
+	}
+	main()
+	os.Exit(0)
+}
+
+// Runs venvy in a process of its own from dir with env added to the environment, returns its stdout and exit code
+func runMain(t *testing.T, dir string, env []string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestMainHelperProcess$", "--"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "VENVY_TEST_MAIN=1"), env...)
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+// A sh script running this test binary as venvy
+func venvyStub() string {
+	return fmt.Sprintf(`VENVY_TEST_MAIN=1 exec %s -test.run='^TestMainHelperProcess$' -- "$@"`, shell.Quote(os.Args[0]))
+}
+
+const stackTestConfig = `[[modules]]
+name = "one_env"
+type = "env"
+	[modules.config.vars]
+	ONE = "1"
+
+[[modules]]
+name = "two_env"
+type = "env"
+	[modules.config.vars]
+	TWO = "2"
+
+[[projects]]
+name = "one"
+modules = ["one_env"]
+
+[[projects]]
+name = "two"
+modules = ["two_env"]
+`
+
+func TestStackedActivations(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+		// Written to the user config when set
+		userConfig string
+		want       string
+	}{
+		{
+			name:   "replace",
+			script: "venvy one; venvy two; show",
+			want:   "unset 2 two",
+		},
+		{
+			name:   "push",
+			script: "venvy one; venvy two --stack; show",
+			want:   "1 2 one,two",
+		},
+		{
+			name:   "pop",
+			script: "venvy one; venvy two --stack; devenv; show; devenv; show",
+			want:   "1 unset one\nunset unset unset",
+		},
+		{
+			name:   "pop all",
+			script: "venvy one; venvy two --stack; devenv --all; show; echo ${DEACTIVATE_F-empty}",
+			want:   "unset unset unset\nempty",
+		},
+		{
+			name:   "replace a stack",
+			script: "venvy one; venvy two --stack; venvy one; show",
+			want:   "1 unset one",
+		},
+		{
+			name:   "already active",
+			script: "venvy one; venvy two --stack; venvy one --stack 2>/dev/null; echo status=$?; show",
+			want:   "status=1\n1 2 one,two",
+		},
+		{
+			name:   "pop restores values the top layer changed",
+			script: "export ONE=outer; venvy one; show; venvy two --stack; devenv; devenv; show",
+			want:   "1 unset one\nouter unset unset",
+		},
+		{
+			name:       "pop removes only the top layer's prompt",
+			script:     "PS1='$ '; venvy one; venvy two --stack; echo \"$PS1\"; devenv; echo \"$PS1\"; devenv; echo \"$PS1\"",
+			userConfig: "[ps1]\nvalue = \"(env)\"\n",
+			want:       "(env) (env) $ \n(env) $ \n$",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t, func(root string) {
+				writeTestFile(t, filepath.Join(root, defaultFileName), stackTestConfig)
+				if tc.userConfig != "" {
+					writeTestFile(t, filepath.Join(dotDir(root), "config.toml"), tc.userConfig)
+				}
+				show := `show(){ echo "${ONE-unset} ${TWO-unset} ${` + activeStackEnvVar + `-unset}"; }; `
+				out := runWithShellInit(t, venvyStub(), "cd "+shell.Quote(root)+"; "+show+tc.script, "HOME="+root)
+				if strings.TrimSpace(out) != tc.want {
+					t.Errorf("got\n%s\nexpected\n%s", out, tc.want)
+				}
+			})
+		})
+	}
+}
+
+func TestBareNamesPreferNearestConfig(t *testing.T) {
+	configs := map[string]string{
+		"a/venvy.toml":         "namespace = \"a\"\n\n[[projects]]\nname = \"app\"\n",
+		"a/b/venvy.toml":       "namespace = \"b\"\n\n[[projects]]\nname = \"app\"\n\n[[projects]]\nname = \"only_b\"\n",
+		"x/venvy.toml":         "namespace = \"x\"\n\n[[projects]]\nname = \"app\"\n",
+		"elsewhere/deep/.keep": "",
+	}
+	cases := []struct {
+		name       string
+		cwd        string
+		searchPath []string
+		project    string
+		// The config dir the project resolves to, empty when it doesn't resolve
+		wantRoot string
+	}{
+		{name: "own config", cwd: "a/b", project: "app", wantRoot: "a/b"},
+		{name: "parent by namespace", cwd: "a/b", project: "a:app", wantRoot: "a"},
+		{name: "own by namespace", cwd: "a/b", project: "b:app", wantRoot: "a/b"},
+		{name: "nearest ancestor", cwd: "a/b/c", project: "app", wantRoot: "a/b"},
+		{name: "ancestor over search path", cwd: "a/b/c", searchPath: []string{"x"}, project: "app", wantRoot: "a/b"},
+		{name: "search path by namespace", cwd: "a/b/c", searchPath: []string{"x"}, project: "x:app", wantRoot: "x"},
+		{name: "nearest search path entry", cwd: "elsewhere/deep", searchPath: []string{"a/b", "x"}, project: "app", wantRoot: "x"},
+		{name: "unique names stay bare", cwd: "elsewhere/deep", searchPath: []string{"a/b", "x"}, project: "only_b", wantRoot: "a/b"},
+		{name: "not found below", cwd: "a", project: "only_b"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t, func(root string) {
+				for name, content := range configs {
+					writeTestFile(t, filepath.Join(root, name), content)
+				}
+				os.MkdirAll(filepath.Join(root, tc.cwd), 0700)
+				searchPath := []string{}
+				for _, entry := range tc.searchPath {
+					searchPath = append(searchPath, filepath.Join(root, entry))
+				}
+				env := []string{
+					"HOME=" + root,
+					"XDG_CONFIG_HOME=" + filepath.Join(root, ".config"),
+					disableHistoryEnvVar + "=1",
+					searchPathEnvVar + "=" + strings.Join(searchPath, string(os.PathListSeparator)),
+				}
+				out, exitCode := runMain(t, filepath.Join(root, tc.cwd), env, tc.project, "--print-root")
+				if tc.wantRoot == "" {
+					if exitCode == 0 {
+						t.Errorf("%s resolved to %s, expected it not to", tc.project, out)
+					}
+					return
+				}
+				if want := filepath.Join(root, tc.wantRoot); strings.TrimSpace(out) != want || exitCode != 0 {
+					t.Errorf("%s resolved to %s (exit %d), expected %s", tc.project, out, exitCode, want)
+				}
+			})
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		env  []string
+		// Expected in the output in this order
+		want []string
+	}{
+		{
+			name: "activation",
+			args: []string{"one", "--dry-run"},
+			want: []string{
+				"# venvy dry run rendered for sh",
+				"# activation", "# module one_env (env)", "export ONE=1", "# venvy metadata", "export " + activeStackEnvVar + "=one",
+				"# deactivation", "# venvy metadata", "# module one_env (env)", "unset ONE",
+			},
+		},
+		{
+			name: "stacked",
+			args: []string{"two", "--dry-run", "--stack"},
+			env:  []string{activeStackEnvVar + "=one"},
+			want: []string{stackMarker, "# activation", "export TWO=2", "export " + activeStackEnvVar + "=one,two"},
+		},
+		{
+			name: "fish",
+			args: []string{"one", "--dry-run"},
+			env:  []string{shellEnvVar + "=fish"},
+			want: []string{"# venvy dry run rendered for fish", "set -gx ONE 1", "set -e ONE"},
+		},
+		{
+			name: "exec",
+			args: []string{"one", "--dry-run", "touch", "ran"},
+			want: []string{"trap _venvy_exec_exit EXIT", "# activation", "export ONE=1", "# command", "touch ran", "# deactivation", "unset ONE"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inTempDir(t, func(root string) {
+				writeTestFile(t, filepath.Join(root, defaultFileName), stackTestConfig)
+				env := append([]string{"HOME=" + root, disableHistoryEnvVar + "=1"}, tc.env...)
+				out, exitCode := runMain(t, root, env, tc.args...)
+				if exitCode != 0 {
+					t.Fatalf("exited with %d:\n%s", exitCode, out)
+				}
+				rest := out
+				for _, want := range tc.want {
+					index := strings.Index(rest, want)
+					if index < 0 {
+						t.Fatalf("%q missing or out of order in\n%s", want, out)
+					}
+					rest = rest[index+len(want):]
+				}
+				if util.PathExists(filepath.Join(root, "ran")) {
+					t.Error("the command ran")
+				}
+			})
+		})
+	}
+}
+
+func TestDryRunLeavesShellAlone(t *testing.T) {
+	inTempDir(t, func(root string) {
+		writeTestFile(t, filepath.Join(root, defaultFileName), stackTestConfig)
+		out := runWithShellInit(t, venvyStub(), "cd "+shell.Quote(root)+"; venvy one --dry-run >/dev/null; echo ${ONE-unset} ${DEACTIVATE_F-unset}", "HOME="+root)
+		if strings.TrimSpace(out) != "unset unset" {
+			t.Errorf("got %q, expected the dry run to change nothing", out)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/pnegahdar/venvy/util"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Where the user config is looked for, ~/.venvy first and then the XDG config dir
+func userConfigDirs() []string {
+	dirs := []string{filepath.Dir(globalPath("config.toml"))}
+	xdgDir := os.Getenv("XDG_CONFIG_HOME")
+	if xdgDir == "" {
+		homeDir, err := homedir.Dir()
+		if err != nil {
+			return dirs
+		}
+		xdgDir = filepath.Join(homeDir, ".config")
+	}
+	return append(dirs, filepath.Join(xdgDir, venvy.ProjectName))
+}
+
+// The first user config found, empty when there is none
+func userConfigPath() string {
+	for _, dir := range userConfigDirs() {
+		for _, ext := range []string{".toml", ".yaml", ".yml", ".json"} {
+			configPath := filepath.Join(dir, "config"+ext)
+			if util.PathExists(configPath) {
+				return configPath
+			}
+		}
+	}
+	return ""
+}
+
+func loadUserConfigFile(configPath string) (*venvy.UserConfig, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, &configError{Path: configPath, Err: err}
+	}
+	jsonData, err := util.ConfigToJson(configPath, data)
+	if err != nil {
+		return nil, newConfigError(configPath, data, fmt.Errorf("unable to parse user config: %w", err))
+	}
+	userConfig := &venvy.UserConfig{}
+	// Strict like module configs, a misspelled key would otherwise be silently ignored
+	err = util.UnmarshalStrict(jsonData, userConfig)
+	if err != nil {
+		return nil, newConfigError(configPath, data, fmt.Errorf("unable to decode user config: %w", err))
+	}
+	if historyMaxAge := userConfig.HistoryMaxAge; historyMaxAge != "" {
+		if _, err := parseMaxAge(historyMaxAge); err != nil {
+			return nil, newConfigError(configPath, data, fmt.Errorf("history_max_age %s is not a duration like 720h or 30d", historyMaxAge))
+		}
+	}
+	userConfig.SourcePath = configPath
+	for _, module := range userConfig.Modules {
+		module.SourcePath = configPath
+	}
+	// Relative search paths are relative to the user config
+	for i, searchPath := range userConfig.SearchPaths {
+		searchPath = util.MustExpandPath(searchPath)
+		if !filepath.IsAbs(searchPath) {
+			searchPath = filepath.Join(filepath.Dir(configPath), searchPath)
+		}
+		userConfig.SearchPaths[i] = searchPath
+	}
+	return userConfig, nil
+}
+
+var loadUserConfigOnce sync.Once
+var loadedUserConfig = &venvy.UserConfig{}
+
+// The user config, empty when there is none or it fails to load
+func userConfig() *venvy.UserConfig {
+	loadUserConfigOnce.Do(func() {
+		configPath := userConfigPath()
+		if configPath == "" {
+			return
+		}
+		userConfig, err := loadUserConfigFile(configPath)
+		if err != nil {
+			logger.Warnf("ignoring user config, run `%s validate` for details: %s", venvy.ProjectName, err)
+			return
+		}
+		logger.Debugf("Loaded user config %s", configPath)
+		loadedUserConfig = userConfig
+	})
+	return loadedUserConfig
+}
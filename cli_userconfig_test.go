@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadUserConfigFile(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "toml",
+			file:    "config.toml",
+			content: "append_modules = [\"tools\"]\nhistory_max_age = \"30d\"\n\n[projects.acme]\nremove_modules = [\"py\"]\n",
+		},
+		{
+			name:    "yaml",
+			file:    "config.yaml",
+			content: "append_modules: [tools]\nprojects:\n  acme:\n    auto_activate: true\n",
+		},
+		{
+			name:    "json",
+			file:    "config.json",
+			content: "{\n  \"append_modules\": [\"tools\"],\n  \"search_paths\": [\"envs\"]\n}\n",
+		},
+		{
+			name:    "toml typo",
+			file:    "config.toml",
+			content: "history = true\napend_modules = [\"tools\"]\n",
+			wantErr: `config.toml:2: unable to decode user config: unknown config key "apend_modules", did you mean "append_modules"?`,
+		},
+		{
+			name:    "yaml nested typo",
+			file:    "config.yaml",
+			content: "projects:\n  acme:\n    remove_module: [py]\n",
+			wantErr: `config.yaml:3: unable to decode user config: unknown config key "remove_module", did you mean "remove_modules"?`,
+		},
+		{
+			name:    "json typo",
+			file:    "config.json",
+			content: "{\n  \"search_path\": [\"envs\"]\n}\n",
+			wantErr: `config.json:2: unable to decode user config: unknown config key "search_path", did you mean "search_paths"?`,
+		},
+		{
+			name:    "unrelated key",
+			file:    "config.toml",
+			content: "colour_scheme = \"dark\"\n",
+			wantErr: `config.toml:1: unable to decode user config: unknown config key "colour_scheme", expected one of `,
+		},
+		{
+			name:    "bad max age",
+			file:    "config.toml",
+			content: "history_max_age = \"a month\"\n",
+			wantErr: "config.toml: history_max_age a month is not a duration like 720h or 30d",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "venvy-user-config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			configPath := filepath.Join(dir, tc.file)
+			if err := ioutil.WriteFile(configPath, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			userConfig, err := loadUserConfigFile(configPath)
+			if tc.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), filepath.Join(dir, tc.wantErr)) {
+					t.Fatalf("got err %v, expected %s", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userConfig.SourcePath != configPath {
+				t.Errorf("source path %s, expected %s", userConfig.SourcePath, configPath)
+			}
+			for _, searchPath := range userConfig.SearchPaths {
+				if searchPath != filepath.Join(dir, "envs") {
+					t.Errorf("search path %s is not relative to the user config", searchPath)
+				}
+			}
+		})
+	}
+}
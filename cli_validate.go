@@ -0,0 +1,379 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/spf13/cobra"
+)
+
+const severityError = "error"
+const severityWarning = "warning"
+
+type diagnostic struct {
+	Path     string
+	Line     int
+	Severity string
+	Message  string
+}
+
+func (d *diagnostic) String() string {
+	location := d.Path
+	if d.Line > 0 {
+		location = fmt.Sprintf("%s:%d", d.Path, d.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, d.Severity, d.Message)
+}
+
+// Matches the header opening a list of definitions in toml, yaml or json
+var sectionHeaderRe = regexp.MustCompile(`^(?:\s*\[\[\s*(\w+)\s*\]\]|(\w+):\s*$|\s*"(\w+)"\s*:\s*\[)`)
+
+type configValidation struct {
+	diagnostics []*diagnostic
+	seen        map[string]bool
+	fileData    map[string][]byte
+}
+
+func (v *configValidation) add(severity string, path string, line int, format string, args ...interface{}) {
+	d := &diagnostic{Path: path, Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)}
+	// Shared modules fail the same way for every project using them
+	if v.seen[d.String()] {
+		return
+	}
+	v.seen[d.String()] = true
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+func (v *configValidation) count(severity string) int {
+	count := 0
+	for _, d := range v.diagnostics {
+		if d.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+func (v *configValidation) fileLines(path string) []string {
+	data, ok := v.fileData[path]
+	if !ok {
+		data, _ = ioutil.ReadFile(path)
+		v.fileData[path] = data
+	}
+	return strings.Split(string(data), "\n")
+}
+
+// Best effort line of a project or module definition, section is "projects" or "modules"
+func (v *configValidation) definitionLine(path string, section string, name string) int {
+	nameRe := nameLineRe(name)
+	fallback := 0
+	currentSection := ""
+	for i, line := range v.fileLines(path) {
+		if match := sectionHeaderRe.FindStringSubmatch(line); match != nil {
+			currentSection = match[1] + match[2] + match[3]
+		}
+		if nameRe.MatchString(line) {
+			if strings.EqualFold(currentSection, section) {
+				return i + 1
+			}
+			if fallback == 0 {
+				fallback = i + 1
+			}
+		}
+	}
+	return fallback
+}
+
+// Matches a toml table header like [[projects]] or [projects.replace_modules]
+var tableHeaderRe = regexp.MustCompile(`^\s*\[\[?[\w.]+\]\]?\s*$`)
+
+// Matches any line starting with a key, ends a value spread over several lines
+var anyKeyLineRe = regexp.MustCompile(`^\s*-?\s*["']?\w+["']?\s*[=:]`)
+
+// Indent of a line's first key, a yaml dash or json brace opening a list item counts as indent. Blank and comment
+// lines are -1.
+func lineIndent(line string) (int, bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return -1, false
+	}
+	if trimmed[0] == '-' || trimmed[0] == '{' {
+		rest := strings.TrimLeft(trimmed[1:], " \t")
+		// A dash needs a space after it, -x is a value
+		if rest != "" && (trimmed[0] == '{' || len(rest) < len(trimmed)-1) {
+			return len(line) - len(rest), true
+		}
+	}
+	return len(line) - len(trimmed), false
+}
+
+// The first and last line of the definition with its name on line nameIndex, both 0 based
+func definitionBlock(lines []string, nameIndex int) (int, int) {
+	keyIndent, startsItem := lineIndent(lines[nameIndex])
+	start := nameIndex
+	for !startsItem && start > 0 {
+		indent, item := lineIndent(lines[start-1])
+		if indent >= 0 && (indent < keyIndent || tableHeaderRe.MatchString(lines[start-1])) {
+			break
+		}
+		start--
+		startsItem = item && indent == keyIndent
+	}
+	end := nameIndex
+	for end+1 < len(lines) {
+		indent, item := lineIndent(lines[end+1])
+		if indent >= 0 && (indent < keyIndent || item && indent == keyIndent || tableHeaderRe.MatchString(lines[end+1])) {
+			break
+		}
+		end++
+	}
+	return start, end
+}
+
+// Line of key in a project or module definition, or when value is given of the entry in key's value mentioning it. 0
+// when it isn't there.
+func (v *configValidation) fieldLine(path string, section string, name string, key string, value string) int {
+	nameLine := v.definitionLine(path, section, name)
+	if nameLine == 0 {
+		return 0
+	}
+	lines := v.fileLines(path)
+	start, end := definitionBlock(lines, nameLine-1)
+	keyRe := keyLineRe(key)
+	valueRe := regexp.MustCompile(fmt.Sprintf(`(^|[\s\[{,"'])%s($|[\s\]},"':])`, regexp.QuoteMeta(value)))
+	for i := start; i <= end; i++ {
+		if !keyRe.MatchString(lines[i]) {
+			continue
+		}
+		if value == "" {
+			return i + 1
+		}
+		if valueRe.MatchString(lines[i][len(keyRe.FindString(lines[i])):]) {
+			return i + 1
+		}
+		for j := i + 1; j <= end && !anyKeyLineRe.MatchString(lines[j]); j++ {
+			if valueRe.MatchString(lines[j]) {
+				return j + 1
+			}
+		}
+		return 0
+	}
+	return 0
+}
+
+// The first of lines that was found
+func firstLine(lines ...int) int {
+	for _, line := range lines {
+		if line > 0 {
+			return line
+		}
+	}
+	return 0
+}
+
+// Errors naming the module or project they're about
+var missingModuleRe = regexp.MustCompile(`^module (\S+) not found which is needed`)
+var listedTwiceRe = regexp.MustCompile(`^module (\S+) is listed twice`)
+var requiresModuleRe = regexp.MustCompile(`^module (\S+) requires module (\S+) which`)
+var extendsErrorRe = regexp.MustCompile(`^project inheritance cycle|extends \S+ which was not found`)
+
+// The line a project's error is about, the project's name when it can't be narrowed down
+func (v *configValidation) projectErrorLine(projectPath string, project *venvy.Project, err error) int {
+	modulesLine := v.fieldLine(projectPath, "projects", project.Name, "modules", "")
+	projectLine := v.definitionLine(projectPath, "projects", project.Name)
+	if match := missingModuleRe.FindStringSubmatch(err.Error()); match != nil {
+		return firstLine(
+			v.fieldLine(projectPath, "projects", project.Name, "modules", match[1]),
+			v.fieldLine(projectPath, "projects", project.Name, "replace_modules", match[1]),
+			v.fieldLine(projectPath, "projects", project.Name, "extends", ""),
+			modulesLine, projectLine)
+	}
+	if match := listedTwiceRe.FindStringSubmatch(err.Error()); match != nil {
+		return firstLine(v.fieldLine(projectPath, "projects", project.Name, "modules", match[1]), modulesLine, projectLine)
+	}
+	if extendsErrorRe.MatchString(err.Error()) {
+		return firstLine(v.fieldLine(projectPath, "projects", project.Name, "extends", ""), projectLine)
+	}
+	return firstLine(modulesLine, projectLine)
+}
+
+func (v *configValidation) checkLoad(configF *foundConfig) {
+	if configF.Config() != nil {
+		return
+	}
+	var configErr *configError
+	if errors.As(configF.loadErr, &configErr) {
+		v.add(severityError, configErr.Path, configErr.Line, "%s", configErr.Err)
+	} else {
+		v.add(severityError, configF.Path, 0, "%s", configF.loadErr)
+	}
+}
+
+// Modules the project lists are marked used, the ones it got to instantiate checked
+func (v *configValidation) checkProject(configManager *venvy.ConfigManager, project *venvy.Project, usedModules, checkedModules map[string]bool) {
+	projectPath := venvy.DefinedIn(project.SourcePath, configManager.ConfigPath())
+	projectLine := v.definitionLine(projectPath, "projects", project.Name)
+	for _, moduleName := range project.Modules {
+		usedModules[moduleName] = true
+	}
+	projectManager, err := configManager.ProjectManager(project.Name)
+	if err != nil {
+		v.add(severityError, projectPath, v.projectErrorLine(projectPath, project, err), "%s", err)
+		return
+	}
+	modulesOk := true
+	for _, moduleName := range projectManager.Project.Modules {
+		usedModules[moduleName] = true
+		checkedModules[moduleName] = true
+		_, err := projectManager.Moduler(moduleName)
+		if err != nil {
+			modulesOk = false
+			module := projectManager.ModuleDefinition(moduleName)
+			modulePath := venvy.DefinedIn(module.SourcePath, configManager.ConfigPath())
+			v.add(severityError, modulePath, v.definitionLine(modulePath, "modules", moduleName), "%s", err)
+		}
+	}
+	// Ordering is only meaningful once every module could be built
+	if modulesOk {
+		if _, err := projectManager.Modulers(); err != nil {
+			if match := requiresModuleRe.FindStringSubmatch(err.Error()); match != nil {
+				module := projectManager.ModuleDefinition(match[1])
+				modulePath := venvy.DefinedIn(module.SourcePath, configManager.ConfigPath())
+				line := firstLine(v.fieldLine(modulePath, "modules", match[1], "requires", match[2]), v.definitionLine(modulePath, "modules", match[1]))
+				v.add(severityError, modulePath, line, "%s", err)
+			} else {
+				v.add(severityError, projectPath, v.projectErrorLine(projectPath, project, err), "%s", err)
+			}
+		}
+	}
+	for _, source := range projectManager.Project.ScriptSubcommands {
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(filepath.Dir(projectPath), source)
+		}
+		if _, err := os.Stat(source); err != nil {
+			line := firstLine(v.fieldLine(projectPath, "projects", project.Name, "script_subcommands", ""), projectLine)
+			v.add(severityWarning, projectPath, line, "script source %s for project %s does not exist", source, project.Name)
+		}
+	}
+}
+
+func validateConfigs(foundConfigs []*foundConfig) (*configValidation, error) {
+	v := &configValidation{seen: map[string]bool{}, fileData: map[string][]byte{}}
+	for _, configF := range foundConfigs {
+		v.checkLoad(configF)
+	}
+	if configPath := userConfigPath(); configPath != "" {
+		if _, err := loadUserConfigFile(configPath); err != nil {
+			var configErr *configError
+			if errors.As(err, &configErr) {
+				v.add(severityError, configErr.Path, configErr.Line, "%s", configErr.Err)
+			} else {
+				v.add(severityError, configPath, 0, "%s", err)
+			}
+		}
+	}
+	loadedConfigs, err := loadConfigManagers(foundConfigs)
+	if err != nil {
+		return nil, err
+	}
+	seenProjects := map[string]string{}
+	for _, loaded := range loadedConfigs {
+		configManager := loaded.manager
+		config := configManager.Config()
+		namespace := configNamespace(loaded.found)
+		usedModules, checkedModules := map[string]bool{}, map[string]bool{}
+		for _, project := range config.Projects {
+			projectPath := venvy.DefinedIn(project.SourcePath, configManager.ConfigPath())
+			qualified := qualifiedName(namespace, project.Name)
+			if existingPath, ok := seenProjects[qualified]; ok {
+				v.add(severityWarning, projectPath, v.definitionLine(projectPath, "projects", project.Name), "project %s is also defined in %s which takes precedence, set a different namespace in one of them", qualified, existingPath)
+			} else if existingPath, ok := seenProjects[project.Name]; ok {
+				seenProjects[qualified] = loaded.found.Path
+				v.add(severityWarning, projectPath, v.definitionLine(projectPath, "projects", project.Name), "project %s is also defined in %s which is nearer, this one is activated as %s", project.Name, existingPath, qualified)
+			} else {
+				seenProjects[qualified] = loaded.found.Path
+				seenProjects[project.Name] = loaded.found.Path
+			}
+			v.checkProject(configManager, project, usedModules, checkedModules)
+		}
+		// Unused modules and the ones of projects that failed to resolve are checked on their own
+		for _, module := range config.Modules {
+			if checkedModules[module.Name] {
+				continue
+			}
+			modulePath := venvy.DefinedIn(module.SourcePath, configManager.ConfigPath())
+			moduleLine := v.definitionLine(modulePath, "modules", module.Name)
+			if err := configManager.CheckModule(module.Name); err != nil {
+				line := moduleLine
+				if match := requiresModuleRe.FindStringSubmatch(err.Error()); match != nil {
+					line = firstLine(v.fieldLine(modulePath, "modules", module.Name, "requires", match[2]), moduleLine)
+				}
+				v.add(severityError, modulePath, line, "%s", err)
+			}
+			// Included files are often shared module libraries, only flag the config's own modules
+			if !usedModules[module.Name] && modulePath == configManager.ConfigPath() {
+				v.add(severityWarning, modulePath, moduleLine, "module %s is not used by any project", module.Name)
+			}
+		}
+	}
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		if v.diagnostics[i].Path != v.diagnostics[j].Path {
+			return v.diagnostics[i].Path < v.diagnostics[j].Path
+		}
+		return v.diagnostics[i].Line < v.diagnostics[j].Line
+	})
+	return v, nil
+}
+
+// A config file is validated alone, a directory is validated as if venvy was run from it
+func configsToValidate(args []string) ([]*foundConfig, error) {
+	if len(args) == 0 {
+		return LoadConfigs(false, false), nil
+	}
+	target, err := filepath.Abs(args[0])
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []*foundConfig{{Path: target, StorageDir: dotDir(filepath.Dir(target))}}, nil
+	}
+	err = os.Chdir(target)
+	if err != nil {
+		return nil, err
+	}
+	return LoadConfigs(false, false), nil
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [path]",
+	Short: "Check configs, their modules and projects for errors",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		foundConfigs, err := configsToValidate(args)
+		errExit(err)
+		if len(foundConfigs) == 0 {
+			errExit(fmt.Errorf("no configs found to validate"))
+		}
+		validation, err := validateConfigs(foundConfigs)
+		errExit(err)
+		for _, d := range validation.diagnostics {
+			fmt.Println(d)
+		}
+		errorCount := validation.count(severityError)
+		fmt.Printf("%d configs checked, %d errors, %d warnings\n", len(foundConfigs), errorCount, validation.count(severityWarning))
+		if errorCount > 0 {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs validate on configPath in a process of its own as it exits, with an empty home so no user config is loaded
+func runValidate(t *testing.T, configPath string) (string, int) {
+	t.Helper()
+	homeDir, err := ioutil.TempDir("", "venvy-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(homeDir)
+	return runMain(t, homeDir, []string{"HOME=" + homeDir, "XDG_CONFIG_HOME=" + filepath.Join(homeDir, ".config")}, "validate", configPath)
+}
+
+func TestValidateReportsLines(t *testing.T) {
+	cases := []struct {
+		name     string
+		file     string
+		content  string
+		want     []string
+		exitCode int
+	}{
+		{
+			name: "toml missing module",
+			file: "venvy.toml",
+			content: `[[modules]]
+name = "env"
+type = "env"
+
+[[projects]]
+name = "acme"
+modules = [
+    "env",
+    "missing",
+]
+`,
+			want:     []string{"venvy.toml:9: error: module missing not found which is needed for project acme"},
+			exitCode: 1,
+		},
+		{
+			name: "yaml missing module",
+			file: "venvy.yaml",
+			content: `modules:
+  - name: env
+    type: env
+projects:
+  - name: other
+    modules: [env]
+  - name: acme
+    root: .
+    modules: [env, missing]
+`,
+			want:     []string{"venvy.yaml:9: error: module missing not found which is needed for project acme"},
+			exitCode: 1,
+		},
+		{
+			name: "json missing module",
+			file: "venvy.json",
+			content: `{
+  "modules": [
+    {
+      "name": "env",
+      "type": "env"
+    }
+  ],
+  "projects": [
+    {
+      "name": "acme",
+      "modules": [
+        "env",
+        "missing"
+      ]
+    }
+  ]
+}
+`,
+			want:     []string{"venvy.json:13: error: module missing not found which is needed for project acme"},
+			exitCode: 1,
+		},
+		{
+			name: "toml missing parent",
+			file: "venvy.toml",
+			content: `[[projects]]
+name = "acme"
+modules = []
+extends = "base"
+`,
+			want:     []string{"venvy.toml:4: error: project acme defined in "},
+			exitCode: 1,
+		},
+		{
+			name: "yaml unknown required module",
+			file: "venvy.yaml",
+			content: `modules:
+  - name: env
+    type: env
+    requires:
+      - other
+projects:
+  - name: acme
+    modules: [env]
+`,
+			want:     []string{"venvy.yaml:5: error: module env requires module other which is not part of project acme"},
+			exitCode: 1,
+		},
+		{
+			name: "json unused module",
+			file: "venvy.json",
+			content: `{
+  "modules": [
+    {"name": "env", "type": "env"},
+    {
+      "name": "unused",
+      "type": "env"
+    }
+  ],
+  "projects": [{"name": "acme", "modules": ["env"]}]
+}
+`,
+			want: []string{"venvy.json:5: warning: module unused is not used by any project", "0 errors, 1 warnings"},
+		},
+		{
+			name: "modules of a project that doesn't resolve are still checked",
+			file: "venvy.toml",
+			content: `[[modules]]
+name = "env"
+type = "env"
+	[modules.config]
+	unknown = 1
+
+[[modules]]
+name = "needy"
+type = "env"
+requires = ["zz"]
+
+[[projects]]
+name = "acme"
+modules = ["env", "needy", "missing"]
+`,
+			want: []string{
+				"venvy.toml:2: error: ",
+				`unknown config key "unknown"`,
+				"venvy.toml:10: error: module needy requires module zz which is not defined in any config",
+				"venvy.toml:14: error: module missing not found which is needed for project acme",
+				"3 errors, 0 warnings",
+			},
+			exitCode: 1,
+		},
+		{
+			name: "unused module requiring an unknown one",
+			file: "venvy.yaml",
+			content: `modules:
+  - name: env
+    type: env
+  - name: needy
+    type: env
+    requires: [zz]
+projects:
+  - name: acme
+    modules: [env]
+`,
+			want:     []string{"venvy.yaml:6: error: module needy requires module zz which is not defined in any config", "venvy.yaml:4: warning: module needy is not used by any project"},
+			exitCode: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "venvy-validate")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			configPath := filepath.Join(dir, tc.file)
+			writeTestFile(t, configPath, tc.content)
+			out, exitCode := runValidate(t, configPath)
+			if exitCode != tc.exitCode {
+				t.Errorf("exited with %d, expected %d:\n%s", exitCode, tc.exitCode, out)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output doesn't contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
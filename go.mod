@@ -16,11 +16,12 @@ require (
 	github.com/peterbourgon/diskv v2.0.1+incompatible
 	github.com/sirupsen/logrus v1.0.4
 	github.com/spf13/cobra v0.0.1
-	github.com/spf13/pflag v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.0
 	github.com/stretchr/testify v1.6.1 // indirect
 	github.com/subosito/gotenv v1.2.0
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v9 v9.11.0
+	gopkg.in/yaml.v2 v2.3.0
 )
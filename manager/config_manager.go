@@ -2,6 +2,10 @@ package venvy
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pnegahdar/venvy/util"
 )
 
 type ConfigManager struct {
@@ -10,48 +14,249 @@ type ConfigManager struct {
 	configPath   string
 	ModuleMakers ModuleMakerTypeMap
 	pmCache      map[string]*ProjectManager
+	// Other discovered configs, searched after this one when resolving extends
+	peers      []*ConfigManager
+	userConfig *UserConfig
 }
 
-func (cm *ConfigManager) ProjectManager(projectName string) (*ProjectManager, error) {
-	cachedV, ok := cm.pmCache[projectName]
-	if ok {
-		return cachedV, nil
+// A project flattened over its extends chain with the module definitions it uses
+type resolvedProject struct {
+	project *Project
+	modules map[string]*Module
+}
+
+func projectRootDir(root string, configPath string) string {
+	configDir := filepath.Dir(configPath)
+	if root == "" {
+		return filepath.Clean(configDir)
+	}
+	root = util.MustExpandPath(root)
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(configDir, root)
 	}
-	var project *Project
+	return root
+}
+
+func (cm *ConfigManager) findProject(projectName string) *Project {
 	for _, proj := range cm.config.Projects {
 		if proj.Name == projectName {
-			project = proj
+			return proj
 		}
 	}
-	if project == nil {
-		return nil, fmt.Errorf("project %s not found in config", projectName)
+	return nil
+}
+
+func (cm *ConfigManager) findModule(moduleName string) *Module {
+	for _, configModule := range cm.config.Modules {
+		if configModule.Name == moduleName {
+			return configModule
+		}
 	}
-	dataManager, err := NewDataManager(cm.StoragePath(projectName))
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+// Projects are looked up in this config first then in the peers in discovery order
+func (cm *ConfigManager) lookupProject(projectName string, skip *Project) (*ConfigManager, *Project) {
+	for _, candidate := range append([]*ConfigManager{cm}, cm.peers...) {
+		if project := candidate.findProject(projectName); project != nil && project != skip {
+			return candidate, project
+		}
 	}
-	relatedModules := map[string]*Module{}
-	for _, moduleName := range project.Modules {
-		for _, configModule := range cm.config.Modules {
-			if configModule.Name == moduleName {
-				relatedModules[moduleName] = configModule
+	return nil, nil
+}
+
+func (cm *ConfigManager) resolveProject(project *Project, chain []string) (*resolvedProject, error) {
+	chainKey := cm.configPath + ":" + project.Name
+	for i, seen := range chain {
+		if seen == chainKey {
+			names := []string{}
+			for _, key := range append(chain[i:], chainKey) {
+				names = append(names, key[strings.LastIndex(key, ":")+1:])
+			}
+			return nil, fmt.Errorf("project inheritance cycle: %s", strings.Join(names, " -> "))
+		}
+	}
+	chain = append(chain, chainKey)
+
+	resolved := &resolvedProject{modules: map[string]*Module{}}
+	flat := *project
+	flat.Modules = nil
+	// Module definitions come from the config declaring the name, then from the parents
+	definitionSources := []*ConfigManager{cm}
+	if project.Extends != "" {
+		// A project may extend one of the same name from another config
+		parentCm, parent := cm.lookupProject(project.Extends, project)
+		if parent == nil {
+			return nil, fmt.Errorf("project %s defined in %s extends %s which was not found in any config", project.Name, DefinedIn(project.SourcePath, cm.configPath), project.Extends)
+		}
+		parentResolved, err := parentCm.resolveProject(parent, chain)
+		if err != nil {
+			return nil, err
+		}
+		for name, module := range parentResolved.modules {
+			resolved.modules[name] = module
+		}
+		definitionSources = append(definitionSources, parentCm)
+		parentSource := DefinedIn(parentResolved.project.SourcePath, parentCm.configPath)
+		if flat.Root == "" {
+			flat.Root = projectRootDir(parentResolved.project.Root, parentSource)
+		}
+		if len(flat.ScriptSubcommands) == 0 {
+			for _, source := range parentResolved.project.ScriptSubcommands {
+				if !filepath.IsAbs(source) {
+					source = filepath.Join(filepath.Dir(parentSource), source)
+				}
+				flat.ScriptSubcommands = append(flat.ScriptSubcommands, source)
+			}
+		}
+		flat.DisableBuiltinModules = flat.DisableBuiltinModules || parentResolved.project.DisableBuiltinModules
+
+		removed := map[string]bool{}
+		for _, name := range project.RemoveModules {
+			removed[name] = true
+		}
+		for _, name := range parentResolved.project.Modules {
+			if replacement, ok := project.ReplaceModules[name]; ok {
+				name = replacement
+			}
+			if !removed[name] {
+				flat.Modules = append(flat.Modules, name)
+			}
+		}
+	}
+	for _, name := range project.Modules {
+		alreadyIncluded := false
+		for _, existing := range flat.Modules {
+			alreadyIncluded = alreadyIncluded || existing == name
+		}
+		if !alreadyIncluded {
+			flat.Modules = append(flat.Modules, name)
+		}
+	}
+	for _, name := range flat.Modules {
+		for _, source := range definitionSources {
+			if module := source.findModule(name); module != nil {
+				resolved.modules[name] = module
 				break
 			}
 		}
-		if _, ok := relatedModules[moduleName]; !ok {
-			return nil, fmt.Errorf("module %s not found which is needed for project %s", moduleName, projectName)
+		if _, ok := resolved.modules[name]; !ok {
+			return nil, fmt.Errorf("module %s not found which is needed for project %s defined in %s", name, project.Name, DefinedIn(project.SourcePath, cm.configPath))
 		}
 	}
+	resolved.project = &flat
+	return resolved, nil
+}
+
+func (cm *ConfigManager) ProjectManager(projectName string) (*ProjectManager, error) {
+	cachedV, ok := cm.pmCache[projectName]
+	if ok {
+		return cachedV, nil
+	}
+	resolved, err := cm.resolveWithUserConfig(projectName)
+	if err != nil {
+		return nil, err
+	}
+	dataManager, err := NewDataManager(cm.StoragePath(projectName))
+	if err != nil {
+		return nil, err
+	}
 	return &ProjectManager{
 		DataManager:    dataManager,
 		configManager:  cm,
-		Project:        project,
-		relatedModules: relatedModules,
+		Project:        resolved.project,
+		relatedModules: resolved.modules,
 	}, nil
 }
 
+func (cm *ConfigManager) resolveWithUserConfig(projectName string) (*resolvedProject, error) {
+	project := cm.findProject(projectName)
+	if project == nil {
+		return nil, fmt.Errorf("project %s not found in config", projectName)
+	}
+	resolved, err := cm.resolveProject(project, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resolved, cm.applyUserConfig(resolved)
+}
+
+// The project as ProjectManager resolves it but without creating its data dir, for lookups that don't activate it
+func (cm *ConfigManager) ResolvedProject(projectName string) (*Project, error) {
+	resolved, err := cm.resolveWithUserConfig(projectName)
+	if err != nil {
+		return nil, err
+	}
+	return resolved.project, nil
+}
+
+// The root dir of a project from this config or one it extends
+func (cm *ConfigManager) ProjectRootDir(project *Project) string {
+	return projectRootDir(project.Root, DefinedIn(project.SourcePath, cm.configPath))
+}
+
+// Builds a module outside of any project and checks its required modules exist, data dirs are not created
+func (cm *ConfigManager) CheckModule(moduleName string) error {
+	module := cm.findModule(moduleName)
+	if module == nil {
+		return fmt.Errorf("module %s not found in config", moduleName)
+	}
+	pm := &ProjectManager{
+		DataManager:    &DataManager{storageDir: cm.StoragePath(moduleName)},
+		configManager:  cm,
+		Project:        &Project{Name: "(none)", Modules: []string{moduleName}, SourcePath: module.SourcePath},
+		relatedModules: map[string]*Module{moduleName: module},
+	}
+	moduler, err := pm.Moduler(moduleName)
+	if err != nil {
+		return err
+	}
+	requires := module.ModuleOrdering.Requires
+	if orderer, ok := moduler.(ModuleOrderer); ok {
+		requires = append(append([]string{}, requires...), orderer.Ordering().Requires...)
+	}
+	for _, required := range requires {
+		if !cm.definesModule(required) {
+			return fmt.Errorf("module %s requires module %s which is not defined in any config", moduleName, required)
+		}
+	}
+	return nil
+}
+
+// Whether the module is defined in this config or one of its peers
+func (cm *ConfigManager) definesModule(moduleName string) bool {
+	for _, candidate := range append([]*ConfigManager{cm}, cm.peers...) {
+		if candidate.findModule(moduleName) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Every module and project defined in the config and its includes
+func (cm *ConfigManager) Config() *Config {
+	return cm.config
+}
+
+func (cm *ConfigManager) ConfigPath() string {
+	return cm.configPath
+}
+
+// Lets projects in any of the configs extend projects in the others
+func LinkConfigManagers(managers ...*ConfigManager) {
+	for _, cm := range managers {
+		cm.peers = nil
+		for _, peer := range managers {
+			if peer != cm {
+				cm.peers = append(cm.peers, peer)
+			}
+		}
+	}
+}
+
 func NewConfigManager(config *Config, configPath string, storageDir string, makerMap ModuleMakerTypeMap) (*ConfigManager, error) {
-	dataManager, err := NewDataManager(storageDir)
+	// Project managers create their own data dirs under it, nothing is written until then
+	dataManager, err := newLazyDataManager(storageDir)
 	if err != nil {
 		return nil, err
 	}
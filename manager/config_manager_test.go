@@ -0,0 +1,158 @@
+package venvy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testModules(names ...string) []*Module {
+	modules := []*Module{}
+	for _, name := range names {
+		modules = append(modules, &Module{Name: name, Type: "env"})
+	}
+	return modules
+}
+
+func TestResolveProjectExtends(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      *Config
+		peer        *Config
+		project     string
+		wantModules []string
+		wantRoot    string
+		wantScripts []string
+		wantErr     string
+	}{
+		{
+			name: "inherits modules, root and scripts",
+			config: &Config{
+				Modules: testModules("py", "node", "tools"),
+				Projects: []*Project{
+					{Name: "base", Root: "src", Modules: []string{"py", "node"}, ScriptSubcommands: []string{"scripts.sh"}},
+					{Name: "acme", Extends: "base", Modules: []string{"tools"}},
+				},
+			},
+			project:     "acme",
+			wantModules: []string{"py", "node", "tools"},
+			wantRoot:    "/configs/src",
+			wantScripts: []string{"/configs/scripts.sh"},
+		},
+		{
+			name: "own settings win",
+			config: &Config{
+				Modules: testModules("py"),
+				Projects: []*Project{
+					{Name: "base", Root: "src", Modules: []string{"py"}, ScriptSubcommands: []string{"scripts.sh"}},
+					{Name: "acme", Extends: "base", Root: "/elsewhere", ScriptSubcommands: []string{"/own.sh"}},
+				},
+			},
+			project:     "acme",
+			wantModules: []string{"py"},
+			wantRoot:    "/elsewhere",
+			wantScripts: []string{"/own.sh"},
+		},
+		{
+			name: "remove and replace",
+			config: &Config{
+				Modules: testModules("py2", "py3", "node", "tools"),
+				Projects: []*Project{
+					{Name: "base", Modules: []string{"py2", "node", "tools"}},
+					{Name: "acme", Extends: "base", RemoveModules: []string{"node"}, ReplaceModules: map[string]string{"py2": "py3"}},
+				},
+			},
+			project:     "acme",
+			wantModules: []string{"py3", "tools"},
+		},
+		{
+			name: "own modules aren't added twice",
+			config: &Config{
+				Modules: testModules("py", "node"),
+				Projects: []*Project{
+					{Name: "base", Modules: []string{"py", "node"}},
+					{Name: "acme", Extends: "base", Modules: []string{"node"}},
+				},
+			},
+			project:     "acme",
+			wantModules: []string{"py", "node"},
+		},
+		{
+			name: "chain",
+			config: &Config{
+				Modules: testModules("a", "b", "c"),
+				Projects: []*Project{
+					{Name: "one", Modules: []string{"a"}},
+					{Name: "two", Extends: "one", Modules: []string{"b"}},
+					{Name: "three", Extends: "two", Modules: []string{"c"}, RemoveModules: []string{"a"}},
+				},
+			},
+			project:     "three",
+			wantModules: []string{"b", "c"},
+		},
+		{
+			name:   "same name in a peer config",
+			config: &Config{Modules: testModules("tools"), Projects: []*Project{{Name: "acme", Extends: "acme", Modules: []string{"tools"}}}},
+			peer: &Config{
+				Modules:  testModules("py"),
+				Projects: []*Project{{Name: "acme", Root: "app", Modules: []string{"py"}}},
+			},
+			project:     "acme",
+			wantModules: []string{"py", "tools"},
+			wantRoot:    "/peer/app",
+		},
+		{
+			name:    "missing parent",
+			config:  &Config{Projects: []*Project{{Name: "acme", Extends: "base"}}},
+			project: "acme",
+			wantErr: "project acme defined in /configs/venvy.toml extends base which was not found in any config",
+		},
+		{
+			name:    "cycle",
+			config:  &Config{Projects: []*Project{{Name: "a", Extends: "b"}, {Name: "b", Extends: "c"}, {Name: "c", Extends: "a"}}},
+			project: "a",
+			wantErr: "project inheritance cycle: a -> b -> c -> a",
+		},
+		{
+			name: "replacement not defined",
+			config: &Config{
+				Modules:  testModules("py2"),
+				Projects: []*Project{{Name: "base", Modules: []string{"py2"}}, {Name: "acme", Extends: "base", ReplaceModules: map[string]string{"py2": "py3"}}},
+			},
+			project: "acme",
+			wantErr: "module py3 not found which is needed for project acme",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := &ConfigManager{config: tc.config, configPath: "/configs/venvy.toml"}
+			if tc.peer != nil {
+				LinkConfigManagers(cm, &ConfigManager{config: tc.peer, configPath: "/peer/venvy.toml"})
+			}
+			resolved, err := cm.resolveProject(cm.findProject(tc.project), nil)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, expected %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(resolved.project.Modules, tc.wantModules) {
+				t.Errorf("modules %v, expected %v", resolved.project.Modules, tc.wantModules)
+			}
+			if tc.wantRoot != "" && resolved.project.Root != tc.wantRoot {
+				t.Errorf("root %s, expected %s", resolved.project.Root, tc.wantRoot)
+			}
+			if tc.wantScripts != nil && !reflect.DeepEqual(resolved.project.ScriptSubcommands, tc.wantScripts) {
+				t.Errorf("scripts %v, expected %v", resolved.project.ScriptSubcommands, tc.wantScripts)
+			}
+			for _, name := range tc.wantModules {
+				if resolved.modules[name] == nil {
+					t.Errorf("module %s has no definition", name)
+				}
+			}
+		})
+	}
+}
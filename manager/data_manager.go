@@ -16,18 +16,26 @@ type DataManager struct {
 }
 
 func (dm *DataManager) setup() error {
-	dataDir := filepath.Join(dm.storageDir, "kvData")
-	err := os.MkdirAll(dataDir, 0700) // also creates storageDir
+	err := os.MkdirAll(dm.kvDir(), 0700) // also creates storageDir
 	if err != nil {
 		return err
 	}
+	dm.openKV()
+	return nil
+}
+
+func (dm *DataManager) kvDir() string {
+	return filepath.Join(dm.storageDir, "kvData")
+}
+
+// diskv only touches the disk on reads and writes, writes create the dirs they need
+func (dm *DataManager) openKV() {
 	splitColonTransform := func(s string) []string { return strings.Split(s, ":") }
 	dm.diskKV = diskv.New(diskv.Options{
-		BasePath:     dataDir,
+		BasePath:     dm.kvDir(),
 		Transform:    splitColonTransform,
 		CacheSizeMax: 1024 * 1024,
 	})
-	return nil
 }
 
 func (dm *DataManager) ChDir(toDir string) error {
@@ -82,9 +90,19 @@ func (dm *DataManager) ReadJson(key string, v interface{}) error {
 
 func NewDataManager(storageDir string) (*DataManager, error) {
 	logger.Debugf("Data store at %s", storageDir)
+	dm, err := newLazyDataManager(storageDir)
+	if err != nil {
+		return nil, err
+	}
+	return dm, dm.setup()
+}
+
+// Like NewDataManager but the storage dir is only created on the first write
+func newLazyDataManager(storageDir string) (*DataManager, error) {
 	if !filepath.IsAbs(storageDir) {
 		return nil, fmt.Errorf("storage dir %s not an absolute path", storageDir)
 	}
 	dm := &DataManager{storageDir: storageDir}
-	return dm, dm.setup()
+	dm.openKV()
+	return dm, nil
 }
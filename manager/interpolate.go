@@ -0,0 +1,190 @@
+package venvy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Matches the $${ escape or a ${...} reference in one of our namespaces, anything else is kept as written
+var interpolationRe = regexp.MustCompile(`\$\$\{|\$\{((?:project|env|module)\.[^}]*|storage)\}`)
+
+// Instantiates the modules of a project once, interpolating their configs on the way
+type moduleInstances struct {
+	pm        *ProjectManager
+	instances map[string]Moduler
+	configs   map[string]map[string]interface{}
+	resolving []string
+}
+
+func newModuleInstances(pm *ProjectManager) *moduleInstances {
+	return &moduleInstances{
+		pm:        pm,
+		instances: map[string]Moduler{},
+		configs:   map[string]map[string]interface{}{},
+	}
+}
+
+// Modules of the project, or any module of its config when only referenced
+func (mi *moduleInstances) definition(moduleName string) *Module {
+	if module, ok := mi.pm.relatedModules[moduleName]; ok {
+		return module
+	}
+	return mi.pm.ConfigManager().findModule(moduleName)
+}
+
+func (mi *moduleInstances) instance(moduleName string) (Moduler, error) {
+	if instance, ok := mi.instances[moduleName]; ok {
+		return instance, nil
+	}
+	for i, resolving := range mi.resolving {
+		if resolving == moduleName {
+			return nil, fmt.Errorf("module reference cycle: %s", strings.Join(append(mi.resolving[i:], moduleName), " -> "))
+		}
+	}
+	mi.resolving = append(mi.resolving, moduleName)
+	defer func() { mi.resolving = mi.resolving[:len(mi.resolving)-1] }()
+
+	pm := mi.pm
+	module := mi.definition(moduleName)
+	if module == nil {
+		return nil, fmt.Errorf("module %s not found for project %s", moduleName, pm.Project.Name)
+	}
+	moduleMaker, ok := pm.ConfigManager().ModuleMakers[module.Type]
+	if !ok {
+		return nil, fmt.Errorf("module %s for project %s has unkown type %s (defined in %s)", moduleName, pm.Project.Name, module.Type, DefinedIn(module.SourcePath, pm.ConfigManager().configPath))
+	}
+	config, err := mi.interpolate(module.Config)
+	if err != nil {
+		return nil, fmt.Errorf("module %s for project %s (defined in %s) has a bad config reference, %s", module.Name, pm.Project.Name, DefinedIn(module.SourcePath, pm.ConfigManager().configPath), err)
+	}
+	prepared := *module
+	prepared.Config = config
+	preparedModule, err := moduleMaker(pm, &prepared)
+	if err != nil {
+		return nil, fmt.Errorf("module %s for project %s (defined in %s) could not initializaed, had err %s", module.Name, pm.Project.Name, DefinedIn(module.SourcePath, pm.ConfigManager().configPath), err)
+	}
+	mi.instances[moduleName] = preparedModule
+	return preparedModule, nil
+}
+
+// Values a module exposes as ${module.<name>.<key>}, its description wins over its raw config keys
+func (mi *moduleInstances) moduleVariable(moduleName string, key string) (string, error) {
+	if mi.definition(moduleName) == nil {
+		return "", fmt.Errorf("unknown module %s", moduleName)
+	}
+	instance, err := mi.instance(moduleName)
+	if err != nil {
+		return "", err
+	}
+	if describer, ok := instance.(ModuleDescriber); ok {
+		if value, ok := describer.Describe()[key]; ok {
+			return value, nil
+		}
+	}
+	if value, ok := mi.configs[moduleName][key]; ok {
+		switch value.(type) {
+		case string, json.Number, bool:
+			return fmt.Sprint(value), nil
+		}
+	}
+	return "", fmt.Errorf("module %s has no value %s", moduleName, key)
+}
+
+func (mi *moduleInstances) resolveReference(reference string) (string, error) {
+	pm := mi.pm
+	if reference == "storage" {
+		return pm.StoragePath(), nil
+	}
+	parts := strings.SplitN(reference, ".", 2)
+	namespace, key := parts[0], parts[1]
+	switch namespace {
+	case "project":
+		configPath := DefinedIn(pm.Project.SourcePath, pm.ConfigManager().configPath)
+		projectVars := map[string]string{
+			"name":       pm.Project.Name,
+			"root":       pm.RootDir(),
+			"config":     configPath,
+			"config_dir": filepath.Dir(configPath),
+		}
+		if value, ok := projectVars[key]; ok {
+			return value, nil
+		}
+	case "env":
+		if value, ok := os.LookupEnv(key); ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("environment variable %s is not set", key)
+	case "module":
+		moduleParts := strings.SplitN(key, ".", 2)
+		if len(moduleParts) == 2 {
+			return mi.moduleVariable(moduleParts[0], moduleParts[1])
+		}
+	}
+	return "", fmt.Errorf("unknown reference ${%s}", reference)
+}
+
+func (mi *moduleInstances) interpolateString(value string) (string, error) {
+	var resolveErr error
+	result := interpolationRe.ReplaceAllStringFunc(value, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		resolved, err := mi.resolveReference(match[2 : len(match)-1])
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		return resolved
+	})
+	return result, resolveErr
+}
+
+func (mi *moduleInstances) interpolateValue(value interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case string:
+		return mi.interpolateString(typed)
+	case []interface{}:
+		for i, item := range typed {
+			interpolated, err := mi.interpolateValue(item)
+			if err != nil {
+				return nil, err
+			}
+			typed[i] = interpolated
+		}
+	case map[string]interface{}:
+		for key, item := range typed {
+			interpolated, err := mi.interpolateValue(item)
+			if err != nil {
+				return nil, err
+			}
+			typed[key] = interpolated
+		}
+	}
+	return value, nil
+}
+
+// Replaces references in every string value of a module config before the module unmarshals it
+func (mi *moduleInstances) interpolate(config json.RawMessage) (json.RawMessage, error) {
+	if len(config) == 0 {
+		return config, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(config))
+	decoder.UseNumber()
+	var target interface{}
+	err := decoder.Decode(&target)
+	if err != nil {
+		return nil, err
+	}
+	interpolated, err := mi.interpolateValue(target)
+	if err != nil {
+		return nil, err
+	}
+	if asMap, ok := interpolated.(map[string]interface{}); ok {
+		mi.configs[mi.resolving[len(mi.resolving)-1]] = asMap
+	}
+	return json.Marshal(interpolated)
+}
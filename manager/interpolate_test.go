@@ -0,0 +1,133 @@
+package venvy
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pnegahdar/venvy/shell"
+)
+
+// Keeps the config it was made with, described as version when it has one
+type recordingModule struct {
+	config map[string]interface{}
+}
+
+func (rm *recordingModule) ActivateScript() (*shell.Script, error) {
+	return shell.New(), nil
+}
+
+func (rm *recordingModule) DeactivateScript() (*shell.Script, error) {
+	return shell.New(), nil
+}
+
+func (rm *recordingModule) Describe() map[string]string {
+	if version, ok := rm.config["described"].(string); ok {
+		return map[string]string{"version": version}
+	}
+	return map[string]string{}
+}
+
+func makeRecordingModule(pm *ProjectManager, self *Module) (Moduler, error) {
+	module := &recordingModule{}
+	if err := json.Unmarshal(self.Config, &module.config); err != nil {
+		return nil, err
+	}
+	return module, nil
+}
+
+func TestInterpolateModuleConfig(t *testing.T) {
+	os.Setenv("VENVY_TEST_INTERPOLATE", "from env")
+	defer os.Unsetenv("VENVY_TEST_INTERPOLATE")
+	cases := []struct {
+		name    string
+		config  string
+		others  map[string]string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:   "project values",
+			config: `{"a": "${project.name} ${project.root}", "b": "${project.config}", "c": "${project.config_dir}/x"}`,
+			want:   map[string]interface{}{"a": "acme /configs/src", "b": "/configs/venvy.toml", "c": "/configs/x"},
+		},
+		{
+			name:   "env and storage",
+			config: `{"a": "${env.VENVY_TEST_INTERPOLATE}", "b": "${storage}/cache"}`,
+			want:   map[string]interface{}{"a": "from env", "b": "/data/acme/cache"},
+		},
+		{
+			name:   "escape and other references kept",
+			config: `{"a": "$${project.name}", "b": "${HOME} $HOME $${", "c": "$$${project.name}"}`,
+			want:   map[string]interface{}{"a": "${project.name}", "b": "${HOME} $HOME ${", "c": "$${project.name}"},
+		},
+		{
+			name:   "nested values",
+			config: `{"list": ["${project.name}", 1, true], "map": {"deep": ["${project.name}"]}, "n": 1.50}`,
+			want:   map[string]interface{}{"list": []interface{}{"acme", 1.0, true}, "map": map[string]interface{}{"deep": []interface{}{"acme"}}, "n": 1.5},
+		},
+		{
+			name:   "other modules",
+			config: `{"a": "${module.py.path}", "b": "${module.py.version}", "c": "${module.py.port}"}`,
+			others: map[string]string{"py": `{"path": "/opt/${project.name}", "described": "3.8", "version": "raw", "port": 8080}`},
+			want:   map[string]interface{}{"a": "/opt/acme", "b": "3.8", "c": "8080"},
+		},
+		{
+			name:    "unset env",
+			config:  `{"a": "${env.VENVY_TEST_NEVER_SET}"}`,
+			wantErr: "environment variable VENVY_TEST_NEVER_SET is not set",
+		},
+		{
+			name:    "unknown project value",
+			config:  `{"a": "${project.owner}"}`,
+			wantErr: "unknown reference ${project.owner}",
+		},
+		{
+			name:    "unknown module",
+			config:  `{"a": "${module.missing.path}"}`,
+			wantErr: "unknown module missing",
+		},
+		{
+			name:    "module without the value",
+			config:  `{"a": "${module.py.path}"}`,
+			others:  map[string]string{"py": `{"nested": {"path": "x"}}`},
+			wantErr: "module py has no value path",
+		},
+		{
+			name:    "cycle",
+			config:  `{"a": "${module.py.path}"}`,
+			others:  map[string]string{"py": `{"path": "${module.node.path}"}`, "node": `{"path": "${module.py.path}"}`},
+			wantErr: "module reference cycle: py -> node -> py",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{Modules: []*Module{{Name: "subject", Type: "recording", Config: json.RawMessage(tc.config)}}}
+			for name, otherConfig := range tc.others {
+				config.Modules = append(config.Modules, &Module{Name: name, Type: "recording", Config: json.RawMessage(otherConfig)})
+			}
+			cm := &ConfigManager{config: config, configPath: "/configs/venvy.toml", ModuleMakers: ModuleMakerTypeMap{"recording": makeRecordingModule}}
+			pm := &ProjectManager{
+				DataManager:    &DataManager{storageDir: "/data/acme"},
+				configManager:  cm,
+				Project:        &Project{Name: "acme", Root: "src", Modules: []string{"subject"}},
+				relatedModules: map[string]*Module{"subject": config.Modules[0]},
+			}
+			moduler, err := pm.Moduler("subject")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, expected %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := moduler.(*recordingModule).config; !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("config %v, expected %v", got, tc.want)
+			}
+		})
+	}
+}
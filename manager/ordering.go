@@ -0,0 +1,151 @@
+package venvy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const allModules = "*"
+
+type orderGraph struct {
+	projectName string
+	modules     []*NamedModuler
+	index       map[string]int
+	// edges[a][b] means a has to run before b
+	edges map[string]map[string]bool
+}
+
+func (og *orderGraph) addEdge(from string, to string) {
+	if from == to {
+		return
+	}
+	if og.edges[from] == nil {
+		og.edges[from] = map[string]bool{}
+	}
+	og.edges[from][to] = true
+}
+
+func hasWildcard(names []string) bool {
+	for _, name := range names {
+		if name == allModules {
+			return true
+		}
+	}
+	return false
+}
+
+func (og *orderGraph) addRelations(name string, ordering ModuleOrdering, orderings map[string]ModuleOrdering) error {
+	for _, after := range ordering.After {
+		if after == allModules {
+			for _, other := range og.modules {
+				if !hasWildcard(orderings[other.Name].After) {
+					og.addEdge(other.Name, name)
+				}
+			}
+		} else if _, ok := og.index[after]; ok {
+			og.addEdge(after, name)
+		}
+	}
+	for _, before := range ordering.Before {
+		if before == allModules {
+			for _, other := range og.modules {
+				if !hasWildcard(orderings[other.Name].Before) {
+					og.addEdge(name, other.Name)
+				}
+			}
+		} else if _, ok := og.index[before]; ok {
+			og.addEdge(name, before)
+		}
+	}
+	for _, required := range ordering.Requires {
+		if _, ok := og.index[required]; !ok {
+			return fmt.Errorf("module %s requires module %s which is not part of project %s", name, required, og.projectName)
+		}
+		og.addEdge(required, name)
+	}
+	return nil
+}
+
+// Every unsorted module has an unsorted predecessor, walk those back until one repeats
+func (og *orderGraph) findCycle(remaining map[string]bool) []string {
+	var start string
+	for _, module := range og.modules {
+		if remaining[module.Name] {
+			start = module.Name
+			break
+		}
+	}
+	seenAt := map[string]int{}
+	path := []string{}
+	current := start
+	for {
+		if at, ok := seenAt[current]; ok {
+			cycle := append(append([]string{}, path[at:]...), current)
+			// Walked backwards, flip to read in run order
+			for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+				cycle[i], cycle[j] = cycle[j], cycle[i]
+			}
+			return cycle
+		}
+		seenAt[current] = len(path)
+		path = append(path, current)
+		for _, module := range og.modules {
+			if remaining[module.Name] && og.edges[module.Name][current] {
+				current = module.Name
+				break
+			}
+		}
+	}
+}
+
+// Topologically sorts modules by their relations, falling back to list order when unconstrained
+func sortModulers(projectName string, modules []*NamedModuler, orderings map[string]ModuleOrdering) ([]*NamedModuler, error) {
+	og := &orderGraph{
+		projectName: projectName,
+		modules:     modules,
+		index:       map[string]int{},
+		edges:       map[string]map[string]bool{},
+	}
+	for i, module := range modules {
+		if _, ok := og.index[module.Name]; ok {
+			return nil, fmt.Errorf("module %s is listed twice in project %s", module.Name, projectName)
+		}
+		og.index[module.Name] = i
+	}
+	for _, module := range modules {
+		err := og.addRelations(module.Name, orderings[module.Name], orderings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	inDegree := map[string]int{}
+	for _, targets := range og.edges {
+		for target := range targets {
+			inDegree[target]++
+		}
+	}
+	remaining := map[string]bool{}
+	for _, module := range modules {
+		remaining[module.Name] = true
+	}
+	sorted := []*NamedModuler{}
+	for len(sorted) < len(modules) {
+		var next *NamedModuler
+		for _, module := range modules {
+			if remaining[module.Name] && inDegree[module.Name] == 0 {
+				next = module
+				break
+			}
+		}
+		if next == nil {
+			cycle := og.findCycle(remaining)
+			return nil, fmt.Errorf("module ordering cycle in project %s: %s", projectName, strings.Join(cycle, " -> "))
+		}
+		delete(remaining, next.Name)
+		for target := range og.edges[next.Name] {
+			inDegree[target]--
+		}
+		sorted = append(sorted, next)
+	}
+	return sorted, nil
+}
@@ -0,0 +1,126 @@
+package venvy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortModulers(t *testing.T) {
+	cases := []struct {
+		name      string
+		modules   []string
+		orderings map[string]ModuleOrdering
+		want      []string
+		wantErr   string
+	}{
+		{
+			name:    "unconstrained keeps list order",
+			modules: []string{"a", "b", "c"},
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name:      "after chain",
+			modules:   []string{"c", "b", "a"},
+			orderings: map[string]ModuleOrdering{"c": {After: []string{"b"}}, "b": {After: []string{"a"}}},
+			want:      []string{"a", "b", "c"},
+		},
+		{
+			name:      "before chain",
+			modules:   []string{"c", "b", "a"},
+			orderings: map[string]ModuleOrdering{"a": {Before: []string{"b"}}, "b": {Before: []string{"c"}}},
+			want:      []string{"a", "b", "c"},
+		},
+		{
+			name:      "after all",
+			modules:   []string{"last", "a", "b"},
+			orderings: map[string]ModuleOrdering{"last": {After: []string{allModules}}},
+			want:      []string{"a", "b", "last"},
+		},
+		{
+			name:      "before all",
+			modules:   []string{"a", "b", "first"},
+			orderings: map[string]ModuleOrdering{"first": {Before: []string{allModules}}},
+			want:      []string{"first", "a", "b"},
+		},
+		{
+			name:    "after all twice keeps list order between them",
+			modules: []string{"y", "a", "x"},
+			orderings: map[string]ModuleOrdering{
+				"y": {After: []string{allModules}},
+				"x": {After: []string{allModules}},
+			},
+			want: []string{"a", "y", "x"},
+		},
+		{
+			name:      "requires",
+			modules:   []string{"app", "db"},
+			orderings: map[string]ModuleOrdering{"app": {Requires: []string{"db"}}},
+			want:      []string{"db", "app"},
+		},
+		{
+			name:      "missing after target is ignored",
+			modules:   []string{"b", "a"},
+			orderings: map[string]ModuleOrdering{"b": {After: []string{"missing"}}, "a": {Before: []string{"missing"}}},
+			want:      []string{"b", "a"},
+		},
+		{
+			name:      "missing required module",
+			modules:   []string{"app"},
+			orderings: map[string]ModuleOrdering{"app": {Requires: []string{"db"}}},
+			wantErr:   "module app requires module db which is not part of project acme",
+		},
+		{
+			name:      "self reference is ignored",
+			modules:   []string{"a", "b"},
+			orderings: map[string]ModuleOrdering{"a": {After: []string{"a"}}},
+			want:      []string{"a", "b"},
+		},
+		{
+			name:      "two module cycle",
+			modules:   []string{"a", "b"},
+			orderings: map[string]ModuleOrdering{"a": {After: []string{"b"}}, "b": {After: []string{"a"}}},
+			wantErr:   "module ordering cycle in project acme: ",
+		},
+		{
+			name:    "three module cycle",
+			modules: []string{"a", "b", "c", "free"},
+			orderings: map[string]ModuleOrdering{
+				"a": {After: []string{"c"}},
+				"b": {After: []string{"a"}},
+				"c": {After: []string{"b"}},
+			},
+			wantErr: "module ordering cycle in project acme: a -> b -> c -> a",
+		},
+		{
+			name:    "duplicate module",
+			modules: []string{"a", "b", "a"},
+			wantErr: "module a is listed twice in project acme",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			modules := []*NamedModuler{}
+			for _, name := range tc.modules {
+				modules = append(modules, &NamedModuler{Name: name})
+			}
+			sorted, err := sortModulers("acme", modules, tc.orderings)
+			if tc.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+					t.Fatalf("got err %v, expected %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, module := range sorted {
+				got = append(got, module.Name)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("sorted %v, expected %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package venvy
 
 import (
 	"fmt"
+	"github.com/pnegahdar/venvy/shell"
 	"github.com/pnegahdar/venvy/util"
+	"os"
 	"path/filepath"
 )
 
 type NamedModuler struct {
 	Name   string
+	Type   string
 	Module Moduler
 }
 
@@ -22,38 +25,42 @@ func (pm *ProjectManager) ConfigManager() *ConfigManager {
 	return pm.configManager
 }
 
+// Instantiated modules of the project sorted by their ordering relations
 func (pm *ProjectManager) Modulers() ([]*NamedModuler, error) {
 	var modules []*NamedModuler
+	orderings := map[string]ModuleOrdering{}
+	instances := newModuleInstances(pm)
 	for _, moduleName := range pm.Project.Modules {
-		module, ok := pm.relatedModules[moduleName]
-		if !ok {
-			return nil, fmt.Errorf("module %s not found for project %s", moduleName, pm.Project.Name)
-		}
-		moduleMaker, ok := pm.ConfigManager().ModuleMakers[module.Type]
-		if !ok {
-			return nil, fmt.Errorf("module %s for project %s has unkown type %s", moduleName, pm.Project.Name, module.Type)
-		}
-		preparedModule, err := moduleMaker(pm, module)
+		preparedModule, err := instances.instance(moduleName)
 		if err != nil {
-			return nil, fmt.Errorf("module %s for project %s could not initializaed, had err %s", module.Name, pm.Project.Name, err)
+			return nil, err
+		}
+		module := pm.relatedModules[moduleName]
+		modules = append(modules, &NamedModuler{Name: moduleName, Type: module.Type, Module: preparedModule})
+		ordering := module.ModuleOrdering
+		if orderer, ok := preparedModule.(ModuleOrderer); ok {
+			intrinsic := orderer.Ordering()
+			ordering.After = append(append([]string{}, ordering.After...), intrinsic.After...)
+			ordering.Before = append(append([]string{}, ordering.Before...), intrinsic.Before...)
+			ordering.Requires = append(append([]string{}, ordering.Requires...), intrinsic.Requires...)
 		}
-		modules = append(modules, &NamedModuler{Name: moduleName, Module: preparedModule})
+		orderings[moduleName] = ordering
 	}
-	return modules, nil
+	return sortModulers(pm.Project.Name, modules, orderings)
+}
+
+// Instantiates a single module of the project, useful to report errors per module
+func (pm *ProjectManager) Moduler(moduleName string) (Moduler, error) {
+	return newModuleInstances(pm).instance(moduleName)
+}
+
+// The config definition used for a module of the project
+func (pm *ProjectManager) ModuleDefinition(moduleName string) *Module {
+	return newModuleInstances(pm).definition(moduleName)
 }
 
 func (pm *ProjectManager) RootDir() string {
-	configDir := filepath.Dir(pm.ConfigManager().configPath)
-	projectRoot := pm.Project.Root
-	if projectRoot == "" {
-		projectRoot = filepath.Clean(configDir)
-	} else {
-		projectRoot = util.MustExpandPath(projectRoot)
-		if !filepath.IsAbs(projectRoot) {
-			projectRoot = filepath.Join(configDir, projectRoot)
-		}
-	}
-	return projectRoot
+	return pm.ConfigManager().ProjectRootDir(pm.Project)
 }
 
 func (pm *ProjectManager) RootPath(elem ...string) string {
@@ -82,46 +89,78 @@ func (pm *ProjectManager) AppendModules(modules ...*Module) {
 	}
 }
 
+// Puts the modules in front of the project's own, modules the project already has are skipped
 func (pm *ProjectManager) PrependModules(modules ...*Module) {
 	// prepend in reverse so left most arg is up front
 	for i := len(modules) - 1; i >= 0; i-- {
+		if pm.hasModule(modules[i].Name) {
+			continue
+		}
 		pm.relatedModules[modules[i].Name] = modules[i]
 		pm.Project.Modules = append([]string{modules[i].Name}, pm.Project.Modules...)
+	}
+}
 
+func (pm *ProjectManager) hasModule(moduleName string) bool {
+	for _, name := range pm.Project.Modules {
+		if name == moduleName {
+			return true
+		}
 	}
+	return false
+}
+
+// Activation and deactivation scripts of a single module, the deactivation also undoes what the activation changed
+type NamedScripts struct {
+	Name       string
+	Type       string
+	Activate   *shell.Script
+	Deactivate *shell.Script
 }
 
-func (pm *ProjectManager) ShellActivateCommands() ([]string, error) {
+// Scripts of every module in activation order. Deactivation runs each module's own script and then undoes what its
+// activation changed, with the environment venvy runs in as the snapshot of the values to restore.
+func (pm *ProjectManager) ModuleScripts() ([]*NamedScripts, error) {
 	modules, err := pm.Modulers()
 	if err != nil {
 		return nil, err
 	}
-	activationCommands := []string{}
-	// Go forwards for activate backwards for deactivate
-	for _, namedModular := range modules {
-		lines, err := namedModular.Module.ShellActivateCommands()
+	scripts := []*NamedScripts{}
+	for _, namedModuler := range modules {
+		moduleActivate, err := namedModuler.Module.ActivateScript()
+		if err != nil {
+			return nil, fmt.Errorf("module %s for project %s could not generate activation script, had err %s", namedModuler.Name, pm.Project.Name, err)
+		}
+		moduleDeactivate, err := namedModuler.Module.DeactivateScript()
 		if err != nil {
-			return nil, fmt.Errorf("module %s for project %s could not generate activation lines, had err %s", namedModular.Name, pm.Project.Name, err)
+			return nil, fmt.Errorf("module %s for project %s could not generate deactivation script, had err %s", namedModuler.Name, pm.Project.Name, err)
 		}
-		activationCommands = append(activationCommands, lines...)
+		moduleDeactivate = shell.New().Extend(moduleDeactivate)
+		if moduleActivate != nil {
+			moduleDeactivate.Extend(moduleActivate.Undo(os.LookupEnv))
+		}
+		scripts = append(scripts, &NamedScripts{
+			Name:       namedModuler.Name,
+			Type:       namedModuler.Type,
+			Activate:   shell.New().Extend(moduleActivate),
+			Deactivate: moduleDeactivate,
+		})
 	}
-	return activationCommands, nil
+	return scripts, nil
 }
 
-func (pm *ProjectManager) ShellDeactivateCommands() ([]string, error) {
-	modules, err := pm.Modulers()
+// Activation and deactivation scripts of the whole project
+func (pm *ProjectManager) Scripts() (activate *shell.Script, deactivate *shell.Script, err error) {
+	moduleScripts, err := pm.ModuleScripts()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	activationCommands := []string{}
 	// Go forwards for activate backwards for deactivate
-	for i := len(modules) - 1; i >= 0; i-- {
-		namedModuler := modules[i]
-		lines, err := namedModuler.Module.ShellDeactivateCommands()
-		if err != nil {
-			return nil, fmt.Errorf("module %s for project %s could not generate activation lines, had err %s", namedModuler.Name, pm.Project.Name, err)
-		}
-		activationCommands = append(activationCommands, lines...)
+	activate = shell.New()
+	deactivate = shell.New()
+	for i := range moduleScripts {
+		activate.Extend(moduleScripts[i].Activate)
+		deactivate.Extend(moduleScripts[len(moduleScripts)-1-i].Deactivate)
 	}
-	return activationCommands, nil
+	return activate, deactivate, nil
 }
@@ -0,0 +1,19 @@
+package venvy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrependModulesSkipsExisting(t *testing.T) {
+	pm := &ProjectManager{Project: &Project{Name: "acme", Modules: []string{"python"}}, relatedModules: map[string]*Module{}}
+	ps1 := &Module{Name: "ps1_builtin", Type: "ps1"}
+	jump := &Module{Name: "jump_builtin", Type: "jump"}
+	for i := 0; i < 2; i++ {
+		pm.PrependModules(ps1, jump)
+	}
+	want := []string{"ps1_builtin", "jump_builtin", "python"}
+	if !reflect.DeepEqual(pm.Project.Modules, want) {
+		t.Errorf("modules %v, expected %v", pm.Project.Modules, want)
+	}
+}
@@ -0,0 +1,116 @@
+package venvy
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Changes the user config makes to a single project, applied after the project's extends are resolved
+type ProjectOverride struct {
+	Modules               []string          `json:"modules"`
+	RemoveModules         []string          `json:"remove_modules"`
+	ReplaceModules        map[string]string `json:"replace_modules"`
+	AutoActivate          *bool             `json:"auto_activate"`
+	DisableBuiltinModules *bool             `json:"disable_builtin_modules"`
+}
+
+// Per-user preferences applied to every project. Settings in the user config win over the project's configs,
+// except for module definitions: modules a project lists are defined by its configs first, modules the user config
+// adds are defined by the user config first.
+type UserConfig struct {
+	Modules []*Module `json:"modules" validate:"dive"`
+	// Modules added to every project after its own
+	AppendModules []string `json:"append_modules"`
+	// Overrides keyed by project name
+	Projects map[string]*ProjectOverride `json:"projects" validate:"dive"`
+	// Config of the builtin ps1 module
+	PS1           json.RawMessage `json:"ps1" validate:"-"`
+	History       *bool           `json:"history"`
+	HistoryMaxAge string          `json:"history_max_age"`
+	// Extra config files or directories to load, like VENVY_PATH
+	SearchPaths []string `json:"search_paths"`
+	// The file the user config was loaded from
+	SourcePath string `json:"-"`
+}
+
+func (uc *UserConfig) findModule(moduleName string) *Module {
+	for _, module := range uc.Modules {
+		if module.Name == moduleName {
+			return module
+		}
+	}
+	return nil
+}
+
+func appendMissing(names []string, name string) []string {
+	for _, existing := range names {
+		if existing == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// Applies the project's override and the appended modules to a resolved project
+func (cm *ConfigManager) applyUserConfig(resolved *resolvedProject) error {
+	uc := cm.userConfig
+	if uc == nil {
+		return nil
+	}
+	project := resolved.project
+	override := uc.Projects[project.Name]
+	if override == nil {
+		override = &ProjectOverride{}
+	}
+	if override.AutoActivate != nil {
+		project.AutoActivate = *override.AutoActivate
+	}
+	if override.DisableBuiltinModules != nil {
+		project.DisableBuiltinModules = *override.DisableBuiltinModules
+	}
+
+	added := map[string]bool{}
+	modules := []string{}
+	for _, name := range project.Modules {
+		if replacement, ok := override.ReplaceModules[name]; ok {
+			name = replacement
+			added[name] = true
+		}
+		modules = appendMissing(modules, name)
+	}
+	for _, name := range append(append([]string{}, override.Modules...), uc.AppendModules...) {
+		if _, ok := resolved.modules[name]; !ok {
+			added[name] = true
+		}
+		modules = appendMissing(modules, name)
+	}
+	removed := map[string]bool{}
+	for _, name := range override.RemoveModules {
+		removed[name] = true
+	}
+	project.Modules = nil
+	for _, name := range modules {
+		if !removed[name] {
+			project.Modules = append(project.Modules, name)
+		}
+	}
+
+	for _, name := range project.Modules {
+		if !added[name] {
+			continue
+		}
+		if module := uc.findModule(name); module != nil {
+			resolved.modules[name] = module
+		} else if module := cm.findModule(name); module != nil {
+			resolved.modules[name] = module
+		} else {
+			return fmt.Errorf("module %s not found which the user config %s adds to project %s", name, uc.SourcePath, project.Name)
+		}
+	}
+	return nil
+}
+
+// The user config applied to the config's projects, nil applies none
+func (cm *ConfigManager) SetUserConfig(userConfig *UserConfig) {
+	cm.userConfig = userConfig
+}
@@ -2,20 +2,54 @@ package venvy
 
 import (
 	"encoding/json"
+
+	"github.com/pnegahdar/venvy/shell"
+	"github.com/pnegahdar/venvy/util"
 )
 
 const ProjectName = "venvy"
 const Version = "0.0.2"
 
+// Ordering relations between the modules of a project, entries are module names or "*" for every other module
+type ModuleOrdering struct {
+	After    []string `json:"after"`
+	Before   []string `json:"before"`
+	Requires []string `json:"requires"`
+}
+
 type Module struct {
 	Name   string          `validate:"cleanName"`
 	Type   string          `validate:"required"`
 	Config json.RawMessage `validate:"-"`
+	ModuleOrdering
+	// Opt out of strict config decoding, e.g. for keys only read through interpolation
+	AllowUnknownKeys bool `json:"allow_unknown_keys"`
+	// The config file the module was defined in, may be an included file
+	SourcePath string `json:"-"`
 }
 
+// Decodes and validates the module config into v, unknown keys are an error unless allowed
+func (m *Module) DecodeConfig(v interface{}) error {
+	if m.AllowUnknownKeys {
+		return util.UnmarshalAndValidate(m.Config, v)
+	}
+	return util.UnmarshalStrict(m.Config, v)
+}
+
+// Modules describe their shell changes as typed scripts, quoting is left to the renderer of each shell
 type Moduler interface {
-	ShellActivateCommands() ([]string, error)
-	ShellDeactivateCommands() ([]string, error)
+	ActivateScript() (*shell.Script, error)
+	DeactivateScript() (*shell.Script, error)
+}
+
+// Modules can optionally describe their resolved state, this is shown by `venvy status`
+type ModuleDescriber interface {
+	Describe() map[string]string
+}
+
+// Modules can optionally declare ordering relations intrinsic to their type, merged with the ones in the config
+type ModuleOrderer interface {
+	Ordering() ModuleOrdering
 }
 
 type Project struct {
@@ -25,11 +59,30 @@ type Project struct {
 	Modules               []string
 	ScriptSubcommands     []string `json:"script_subcommands"`
 	DisableBuiltinModules bool     `json:"disable_builtin_modules"`
+	AutoActivate          bool     `json:"auto_activate"`
+	// Inherit root, modules, script_subcommands and builtin settings from another project
+	Extends        string            `json:"extends" validate:"omitempty,cleanName"`
+	RemoveModules  []string          `json:"remove_modules"`
+	ReplaceModules map[string]string `json:"replace_modules"`
+	// The config file the project was defined in, relative paths resolve against it
+	SourcePath string `json:"-"`
 }
 
 type Config struct {
 	Projects []*Project `validate:"dive"`
 	Modules  []*Module  `validate:"dive"`
+	// Other config files merged into this one, relative to this file
+	Include []string `json:"include"`
+	// Qualifies the config's project commands as namespace:project, defaults to the repo or dir name
+	Namespace string `json:"namespace" validate:"omitempty,cleanName"`
+}
+
+// The file a definition came from, falling back to the config that was loaded
+func DefinedIn(sourcePath string, configPath string) string {
+	if sourcePath != "" {
+		return sourcePath
+	}
+	return configPath
 }
 
 // Modules need to implement the following initialization interface
@@ -1,17 +1,32 @@
 package modules
 
-import "github.com/pnegahdar/venvy/manager"
+import (
+	"github.com/pnegahdar/venvy/manager"
+	"github.com/pnegahdar/venvy/shell"
+)
 
 type DebugModule struct{}
 
-func (ps *DebugModule) ShellActivateCommands() ([]string, error) {
-	return []string{"set -x"}, nil
+// Debug has no options, decoded only so stray keys are reported
+type DebugConfig struct{}
+
+func (ps *DebugModule) ActivateScript() (*shell.Script, error) {
+	return shell.New().Add(shell.Trace{On: true}), nil
+}
+
+func (ps *DebugModule) DeactivateScript() (*shell.Script, error) {
+	return shell.New().Add(shell.Trace{On: false}), nil
 }
 
-func (ps *DebugModule) ShellDeactivateCommands() ([]string, error) {
-	return []string{"set +x"}, nil
+// Tracing is enabled before every other module and disabled after them
+func (ps *DebugModule) Ordering() venvy.ModuleOrdering {
+	return venvy.ModuleOrdering{Before: []string{"*"}}
 }
 
 func NewDebugModule(manager *venvy.ProjectManager, self *venvy.Module) (venvy.Moduler, error) {
+	err := self.DecodeConfig(&DebugConfig{})
+	if err != nil {
+		return nil, err
+	}
 	return &DebugModule{}, nil
 }
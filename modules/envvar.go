@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/pnegahdar/venvy/manager"
-	"github.com/pnegahdar/venvy/util"
+	"github.com/pnegahdar/venvy/shell"
 	"github.com/subosito/gotenv"
 	"io/ioutil"
-	"os"
+	"sort"
+	"strings"
 )
 
 type EnvVarConfig struct {
@@ -21,9 +22,9 @@ type EnvvarModule struct {
 	manager *venvy.ProjectManager
 }
 
-func (ev *EnvvarModule) ShellActivateCommands() ([]string, error) {
-	commands := []string{}
-
+// Vars from the env files first so the config vars win, each group in name order
+func (ev *EnvvarModule) vars() ([][2]string, error) {
+	vars := [][2]string{}
 	for _, file := range ev.config.Files {
 		fullPath := ev.manager.ResolveRootPath(file)
 		data, err := ioutil.ReadFile(fullPath)
@@ -31,45 +32,53 @@ func (ev *EnvvarModule) ShellActivateCommands() ([]string, error) {
 			return nil, fmt.Errorf("unable to find file %s at %s", file, fullPath)
 		}
 		pairs := gotenv.Parse(bytes.NewReader(data))
-		for key, value := range pairs {
-			commands = append(commands, fmt.Sprintf(`export %s="%s"`, key, value))
+		for _, key := range sortedKeys(pairs) {
+			vars = append(vars, [2]string{key, pairs[key]})
 		}
 	}
-
-	for key, value := range ev.config.Vars {
-		commands = append(commands, fmt.Sprintf(`export %s="%s"`, key, value))
+	for _, key := range sortedKeys(ev.config.Vars) {
+		vars = append(vars, [2]string{key, ev.config.Vars[key]})
 	}
-	for _, varToUnset := range ev.config.UnsetVars {
-		commands = append(commands, fmt.Sprintf(`unset %s`, varToUnset))
+	return vars, nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
 	}
-	return commands, nil
+	sort.Strings(keys)
+	return keys
 }
 
-func (ev *EnvvarModule) ShellDeactivateCommands() ([]string, error) {
-	commands := []string{}
-	// Unset vars or return to former (current) value
-	for key, _ := range ev.config.Vars {
-		currentValue, exists := os.LookupEnv(key)
-		if exists {
-			// Revert to the old value
-			commands = append(commands, fmt.Sprintf(`export %s="%s"`, key, currentValue))
-		} else {
-			commands = append(commands, fmt.Sprintf("unset %s", key))
-		}
+func (ev *EnvvarModule) ActivateScript() (*shell.Script, error) {
+	vars, err := ev.vars()
+	if err != nil {
+		return nil, err
 	}
-	// Put the unset vars back on deactivation
-	for _, varToUnset := range ev.config.UnsetVars {
-		currentValue, exists := os.LookupEnv(varToUnset)
-		if exists {
-			commands = append(commands, fmt.Sprintf(`export %s="%s"`, varToUnset, currentValue))
-		}
+	script := shell.New()
+	for _, pair := range vars {
+		script.Set(pair[0], pair[1])
+	}
+	return script.Unset(ev.config.UnsetVars...), nil
+}
+
+// The vars set or unset are restored from the activation snapshot
+func (ev *EnvvarModule) DeactivateScript() (*shell.Script, error) {
+	return nil, nil
+}
+
+func (ev *EnvvarModule) Describe() map[string]string {
+	return map[string]string{
+		"vars":       strings.Join(sortedKeys(ev.config.Vars), ","),
+		"files":      strings.Join(ev.config.Files, ","),
+		"unset_vars": strings.Join(ev.config.UnsetVars, ","),
 	}
-	return commands, nil
 }
 
 func NewEnvVarModule(manager *venvy.ProjectManager, self *venvy.Module) (venvy.Moduler, error) {
 	moduleConfig := &EnvVarConfig{}
-	err := util.UnmarshalEmpty(self.Config, moduleConfig)
+	err := self.DecodeConfig(moduleConfig)
 	if err != nil {
 		return nil, err
 	}
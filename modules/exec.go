@@ -2,7 +2,7 @@ package modules
 
 import (
 	"github.com/pnegahdar/venvy/manager"
-	"github.com/pnegahdar/venvy/util"
+	"github.com/pnegahdar/venvy/shell"
 )
 
 type ExecConfig struct {
@@ -15,18 +15,25 @@ type ExecModule struct {
 	config  *ExecConfig
 }
 
-func (ps *ExecModule) ShellActivateCommands() ([]string, error) {
-	return ps.config.ActivationCommands, nil
+func rawScript(commands []string) *shell.Script {
+	script := shell.New()
+	for _, command := range commands {
+		script.RunRaw(command)
+	}
+	return script
+}
 
+func (ps *ExecModule) ActivateScript() (*shell.Script, error) {
+	return rawScript(ps.config.ActivationCommands), nil
 }
 
-func (ps *ExecModule) ShellDeactivateCommands() ([]string, error) {
-	return ps.config.DeactivationCommands, nil
+func (ps *ExecModule) DeactivateScript() (*shell.Script, error) {
+	return rawScript(ps.config.DeactivationCommands), nil
 }
 
 func NewExecModule(manager *venvy.ProjectManager, self *venvy.Module) (venvy.Moduler, error) {
 	moduleConfig := &ExecConfig{}
-	err := util.UnmarshalEmpty(self.Config, moduleConfig)
+	err := self.DecodeConfig(moduleConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -1,15 +1,14 @@
 package modules
 
 import (
-	"fmt"
 	"github.com/pnegahdar/venvy/manager"
-	"github.com/pnegahdar/venvy/util"
+	"github.com/pnegahdar/venvy/shell"
 	"os"
 )
 
 type JumpConfig struct {
-	ToDir           string
-	DisableJumpBack bool
+	ToDir           string `json:"to_dir"`
+	DisableJumpBack bool   `json:"disable_jump_back"`
 }
 
 type JumpModule struct {
@@ -18,21 +17,25 @@ type JumpModule struct {
 	config  *JumpConfig
 }
 
-func (jm *JumpModule) ShellActivateCommands() ([]string, error) {
-	return []string{fmt.Sprintf("cd %s", jm.config.ToDir)}, nil
+func (jm *JumpModule) ActivateScript() (*shell.Script, error) {
+	return shell.New().Cd(jm.config.ToDir), nil
 }
 
-func (jm *JumpModule) ShellDeactivateCommands() ([]string, error) {
+func (jm *JumpModule) DeactivateScript() (*shell.Script, error) {
 	if jm.lastDir != "" && !jm.config.DisableJumpBack {
-		return []string{fmt.Sprintf("cd %s", jm.lastDir)}, nil
+		return shell.New().Cd(jm.lastDir), nil
 	}
 	return nil, nil
 }
 
+func (jm *JumpModule) Describe() map[string]string {
+	return map[string]string{"to_dir": jm.config.ToDir}
+}
+
 func NewJumpModule(manager *venvy.ProjectManager, self *venvy.Module) (venvy.Moduler, error) {
 	moduleConfig := &JumpConfig{}
 	lastDir, _ := os.Getwd()
-	err := util.UnmarshalEmpty(self.Config, moduleConfig)
+	err := self.DecodeConfig(moduleConfig)
 	if err != nil {
 		return nil, err
 	}
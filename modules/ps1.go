@@ -4,15 +4,15 @@ import (
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/pnegahdar/venvy/manager"
-	"github.com/pnegahdar/venvy/util"
+	"github.com/pnegahdar/venvy/shell"
 	"strconv"
 	"strings"
 )
 
 type PS1Config struct {
-	Value     string
-	ZshValue  string
-	BashValue string
+	Value     string `json:"value"`
+	ZshValue  string `json:"zsh_value"`
+	BashValue string `json:"bash_value"`
 }
 
 type PS1Module struct {
@@ -50,25 +50,26 @@ func colorString(data string, attrs ...color.Attribute) string {
 	return noLengthEscape(colorPrefix) + data + noLengthEscape(colorSuffix)
 }
 
-func (ps *PS1Module) ShellActivateCommands() ([]string, error) {
-	return []string{
-		`export OLD_PS1="$PS1"`,
-		fmt.Sprintf(`GENERIC_PS1="%s"`, ps.config.Value),
-		fmt.Sprintf(`BASH_PS1="%s"`, ps.config.BashValue),
-		fmt.Sprintf(`ZSH_PS1="%s"`, ps.config.ZshValue),
-		fmt.Sprintf(`if [ -n "$ZSH_VERSION" ]; then export PS1="$ZSH_PS1 $PS1"; elif [ -n "$BASH_VERSION" ]; then export PS1="$BASH_PS1 $PS1"; else export PS1="$GENERIC_PS1 $PS1";  fi`),
-	}, nil
+// Fish has no PS1, its prompt is wrapped by shell-init instead
+func (ps *PS1Module) ActivateScript() (*shell.Script, error) {
+	prefix := func(value string) *shell.Script {
+		return shell.New().Add(shell.Prepend{Name: "PS1", Value: value, Separator: " "})
+	}
+	withPrefix := shell.New().If(shell.ShellIs{Name: shell.Zsh},
+		prefix(ps.config.ZshValue),
+		shell.New().If(shell.ShellIs{Name: shell.Bash}, prefix(ps.config.BashValue), prefix(ps.config.Value)),
+	)
+	return shell.New().If(shell.Not{Condition: shell.ShellIs{Name: shell.Fish}}, withPrefix, nil), nil
 }
 
-func (ps *PS1Module) ShellDeactivateCommands() ([]string, error) {
-	return []string{
-		`if [ ! -z "$OLD_PS1" ]; then export PS1="$OLD_PS1"; unset OLD_PS1; fi`,
-	}, nil
+// The prefix is cut back out of PS1 by the activation snapshot, keeping prompt changes made during the session
+func (ps *PS1Module) DeactivateScript() (*shell.Script, error) {
+	return nil, nil
 }
 
 func NewPS1Module(manager *venvy.ProjectManager, self *venvy.Module) (venvy.Moduler, error) {
 	moduleConfig := &PS1Config{}
-	err := util.UnmarshalEmpty(self.Config, moduleConfig)
+	err := self.DecodeConfig(moduleConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/pnegahdar/venvy/manager"
+	"github.com/pnegahdar/venvy/shell"
 	"github.com/pnegahdar/venvy/util"
 	"io/ioutil"
 	"path/filepath"
@@ -17,8 +18,8 @@ const DefaultVirtualenv = "virtualenv"
 const DefaultPipInstallCommand = "pip install"
 
 type PyModuleConfig struct {
-	Python               string
-	Dependencies         []string
+	Python               string   `json:"python"`
+	Dependencies         []string `json:"dependencies"`
 	AdditionalTrackFiles []string `json:"additional_track_files"`
 	VirtualEnvCommand    string   `json:"virtualenv_command"`
 }
@@ -34,14 +35,11 @@ func (pm *PythonModule) venvDir() string {
 }
 
 // All the activation needed, essentially what venv/bin/activate does
-func (pm *PythonModule) venvEnvarModule() *EnvvarModule {
-	return &EnvvarModule{config: &EnvVarConfig{
-		Vars: map[string]string{
-			"VIRTUAL_ENV": pm.venvDir(),
-			"PATH":        fmt.Sprintf("%s/bin:${PATH}", pm.venvDir()),
-		},
-		UnsetVars: []string{"PYTHONHOME"},
-	}}
+func (pm *PythonModule) venvScript() *shell.Script {
+	return shell.New().
+		Set("VIRTUAL_ENV", pm.venvDir()).
+		PrependPath("PATH", filepath.Join(pm.venvDir(), "bin")).
+		Unset("PYTHONHOME")
 }
 
 func (pm *PythonModule) autoInstallHashPath() string {
@@ -95,74 +93,67 @@ func (pm *PythonModule) autoInstallCalculateDepHash() (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-func (pm *PythonModule) autoInstallCmds() []string {
-	cmds := []string{}
+func (pm *PythonModule) autoInstallScript() *shell.Script {
+	script := shell.New()
 	for _, dep := range pm.config.Dependencies {
 		// This is a install command, simply add
 		if strings.HasPrefix(dep, "!") {
-			cmds = append(cmds, strings.TrimPrefix(dep, "!"))
+			script.RunRaw(strings.TrimPrefix(dep, "!"))
 			continue
 		}
-		cmd := DefaultPipInstallCommand + " "
+		args := strings.Fields(DefaultPipInstallCommand)
 		if strings.HasSuffix(dep, ".txt") {
-			fullPath := pm.manager.RootPath(dep)
-			cmd += fmt.Sprintf("-r %s", fullPath)
+			args = append(args, "-r", pm.manager.RootPath(dep))
 		} else {
-			cmd += dep
+			args = append(args, dep)
 		}
-		cmds = append(cmds, cmd)
+		script.Run(args...)
 	}
-	return cmds
+	return script
 }
 
 func (pm *PythonModule) venvExists() bool {
 	return util.PathExists(filepath.Join(pm.venvDir(), "bin"))
 }
 
-func (pm *PythonModule) ShellActivateCommands() ([]string, error) {
+func (pm *PythonModule) ActivateScript() (*shell.Script, error) {
 	currentDepHash, err := pm.autoInstallCalculateDepHash()
 	if err != nil {
 		return nil, err
 	}
 	lastDepHash := pm.autoInstallLastHash()
 	hashChanged := currentDepHash != lastDepHash
-	lines := []string{}
-	addArgs := func(args ...string) {
-		lines = append(lines, strings.Join(args, " "))
-	}
+	script := shell.New()
 	if !pm.venvExists() {
 		// Create the venv [virtualenv -p python /path/to/venv]
-		addArgs(pm.config.VirtualEnvCommand, "-p", pm.config.Python, pm.venvDir())
-	}
-
-	eVModule := pm.venvEnvarModule()
-	evCommands, err := eVModule.ShellActivateCommands()
-	if err != nil {
-		return nil, err
+		script.Run(append(strings.Fields(pm.config.VirtualEnvCommand), "-p", pm.config.Python, pm.venvDir())...)
 	}
-	lines = append(lines, evCommands...)
+	script.Extend(pm.venvScript())
 
 	if hashChanged && len(pm.config.Dependencies) > 0 {
 		// run the install [pip install -r requirements.txt deps]
-		lines = append(lines, pm.autoInstallCmds()...)
+		script.Extend(pm.autoInstallScript())
 		// write the hash so we don't reinstall these deps [echo sd2if1jdfs > .venvy/project/pyvenv/auto_install.txt]
-		addArgs("echo", currentDepHash, ">", pm.autoInstallHashPath())
+		script.RunRaw(fmt.Sprintf("echo %s > %s", currentDepHash, shell.Quote(pm.autoInstallHashPath())))
 	}
-	return lines, nil
+	return script, nil
 }
 
-func (pm *PythonModule) ShellDeactivateCommands() ([]string, error) {
-	evModule := pm.venvEnvarModule()
-	lines, err := evModule.ShellDeactivateCommands()
-	if err != nil {
-		return nil, err
+// The venv bin dir is dropped from PATH and the other vars restored from the activation snapshot
+func (pm *PythonModule) DeactivateScript() (*shell.Script, error) {
+	return nil, nil
+}
+
+func (pm *PythonModule) Describe() map[string]string {
+	return map[string]string{
+		"python":   pm.config.Python,
+		"venv_dir": pm.venvDir(),
 	}
-	return lines, nil
 }
 
 func NewPythonModule(manager *venvy.ProjectManager, self *venvy.Module) (venvy.Moduler, error) {
 	moduleConfig := &PyModuleConfig{}
-	err := util.UnmarshalEmpty(self.Config, moduleConfig)
+	err := self.DecodeConfig(moduleConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -2,7 +2,7 @@ package modules
 
 import (
 	"github.com/pnegahdar/venvy/manager"
-	"github.com/pnegahdar/venvy/util"
+	"github.com/pnegahdar/venvy/shell"
 	logger "github.com/sirupsen/logrus"
 	"os/exec"
 
@@ -11,17 +11,15 @@ import (
 )
 
 type Pane struct {
-	Root     string
-	Commands []string
+	Root     string   `json:"root"`
+	Commands []string `json:"commands"`
 }
 
-var pf = fmt.Sprintf
-
 type TmuxWindowConfig struct {
 	DisableDestroyExisting bool   `json:"disable_destroy_existing"`
-	Name                   string `validate:"required"`
-	Panes                  []Pane
-	Layout                 string // even-horizontal, even-vertical, main-horizontal, main-vertical, tiled
+	Name                   string `json:"name" validate:"required"`
+	Panes                  []Pane `json:"panes"`
+	Layout                 string `json:"layout"` // even-horizontal, even-vertical, main-horizontal, main-vertical, tiled
 }
 
 // TODO: tmux when zsh plugin is not enabled
@@ -30,7 +28,7 @@ type TmuxWindow struct {
 	config  *TmuxWindowConfig
 }
 
-func (tx *TmuxWindow) ShellActivateCommands() ([]string, error) {
+func (tx *TmuxWindow) ActivateScript() (*shell.Script, error) {
 	currentTmuxSession, err := tmuxCurrentSession()
 	if err != nil {
 		return nil, err
@@ -49,47 +47,47 @@ func (tx *TmuxWindow) ShellActivateCommands() ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not list current tmux windows with err %s", err)
 	}
-	commands := []string{}
+	script := shell.New()
 	for _, window := range existingWindows {
 		if targetWindowName == window.Name {
 			if tx.config.DisableDestroyExisting {
 				return nil, fmt.Errorf("window with name %s already exists and disable_destory_existing set to true", targetWindowName)
 			} else {
 				// Kill the existing window
-				commands = append(commands, pf("tmux kill-window -t %s", window.ID))
+				script.Run("tmux", "kill-window", "-t", window.ID)
 			}
 		}
 	}
-	// Note tmux allows us to send all these commands as a single chained command. This less prone to syntax errors.
+	// The window is unique in the session once existing ones are killed, target it by name. Splits make the new pane active.
+	target := ":" + targetWindowName
 	for i, pane := range tx.config.Panes {
 		paneRootDir := tx.manager.RootPath(pane.Root)
 		if i == 0 {
-			commands = append(commands,
-				pf("lastWindow=$(tmux new-window -P -c %s -n %s)", paneRootDir, targetWindowName),
-			)
+			script.Run("tmux", "new-window", "-c", paneRootDir, "-n", targetWindowName)
 		} else {
-			commands = append(commands,
-				pf(`lastWindow=$(tmux split-window -P -c %s -t "${lastWindow}")`, paneRootDir),
-			)
+			script.Run("tmux", "split-window", "-c", paneRootDir, "-t", target)
 		}
 		if len(pane.Commands) > 0 {
 			paneCommand := strings.Join(pane.Commands, ";")
-			commands = append(commands,
-				// C-m sends enter
-				pf(`tmux send-keys -t "${lastWindow}" '%s' C-m`, paneCommand),
-			)
+			// C-m sends enter
+			script.Run("tmux", "send-keys", "-t", target, paneCommand, "C-m")
 		}
 
 		// Set layout every time to make sure the panes fit as desired (tmux err: pane too small)
-		commands = append(commands,
-			pf(`tmux select-layout -t "${lastWindow}" %s`, tx.config.Layout),
-		)
+		script.Run("tmux", "select-layout", "-t", target, tx.config.Layout)
 	}
 
-	return commands, nil
+	return script, nil
+}
+
+func (tx *TmuxWindow) Describe() map[string]string {
+	return map[string]string{
+		"window": fmt.Sprintf("%s-%s", tx.manager.Project.Name, tx.config.Name),
+		"layout": tx.config.Layout,
+	}
 }
 
-func (tx *TmuxWindow) ShellDeactivateCommands() ([]string, error) {
+func (tx *TmuxWindow) DeactivateScript() (*shell.Script, error) {
 	return nil, nil
 }
 
@@ -128,7 +126,7 @@ func tmuxCurrentWindow() (string, error) {
 
 func NewTmuxModule(manager *venvy.ProjectManager, self *venvy.Module) (venvy.Moduler, error) {
 	moduleConfig := &TmuxWindowConfig{}
-	err := util.UnmarshalAndValidate(self.Config, moduleConfig)
+	err := self.DecodeConfig(moduleConfig)
 	if err != nil {
 		return nil, err
 	}
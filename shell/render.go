@@ -0,0 +1,269 @@
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Words that need no quoting in either shell, = is left out as an unquoted NAME=value command word is an assignment
+var safeWordRe = regexp.MustCompile(`^[A-Za-z0-9_@%+:,./-]+$`)
+
+// Quote a value as a single posix word, single quotes keep $, backticks, " and newlines literal
+func Quote(value string) string {
+	if safeWordRe.MatchString(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
+
+// Quote a value as a single fish word, only \ and ' are special in fish single quotes
+func FishQuote(value string) string {
+	if safeWordRe.MatchString(value) {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// Escape a value for use inside posix double quotes
+func doubleQuoteEscape(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return replacer.Replace(value)
+}
+
+func quoteWords(words []string, quote func(string) string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = quote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Fish keeps variables ending in PATH as lists, split them so fish itself sees every entry
+func isFishPathList(name string) bool {
+	return strings.HasSuffix(name, "PATH")
+}
+
+// Renders the script for the named shell, every action only runs if the ones before it succeeded
+func Render(shellName string, script *Script) string {
+	script = resolveStatic(shellName, script)
+	if shellName == Fish {
+		return renderFish(script)
+	}
+	return renderPosix(script)
+}
+
+// Whether a condition is already decided by the shell being rendered for, bash and zsh are only known at runtime
+func staticCondition(shellName string, condition Condition) (value bool, known bool) {
+	switch typed := condition.(type) {
+	case ShellIs:
+		if shellName == Fish || typed.Name == Fish {
+			return shellName == typed.Name, true
+		}
+		if typed.Name == Posix {
+			return true, true
+		}
+	case Not:
+		value, known := staticCondition(shellName, typed.Condition)
+		return !value, known
+	}
+	return false, false
+}
+
+// Inlines the branch taken by conditions decided at render time
+func resolveStatic(shellName string, script *Script) *Script {
+	if script == nil {
+		return nil
+	}
+	resolved := New()
+	for _, action := range script.Actions {
+		switch typed := action.(type) {
+		case If:
+			if value, known := staticCondition(shellName, typed.Condition); known {
+				if value {
+					resolved.Extend(resolveStatic(shellName, typed.Then))
+				} else {
+					resolved.Extend(resolveStatic(shellName, typed.Else))
+				}
+				continue
+			}
+			typed.Then = resolveStatic(shellName, typed.Then)
+			typed.Else = resolveStatic(shellName, typed.Else)
+			resolved.Add(typed)
+		case DefineFunction:
+			typed.Body = resolveStatic(shellName, typed.Body)
+			resolved.Add(typed)
+		default:
+			resolved.Add(action)
+		}
+	}
+	return resolved
+}
+
+func renderPosix(script *Script) string {
+	if script.Empty() {
+		return ":"
+	}
+	lines := []string{}
+	for _, action := range script.Actions {
+		lines = append(lines, renderPosixAction(action))
+	}
+	return strings.Join(lines, " && \\\n")
+}
+
+func renderPosixAction(action Action) string {
+	switch typed := action.(type) {
+	case SetVar:
+		return fmt.Sprintf("export %s=%s", typed.Name, Quote(typed.Value))
+	case UnsetVar:
+		return fmt.Sprintf("unset %s", typed.Name)
+	case CopyVar:
+		return fmt.Sprintf(`export %s="$%s"`, typed.To, typed.From)
+	case Prepend:
+		return fmt.Sprintf(`export %s=%s"${%s:+%s$%s}"`, typed.Name, Quote(typed.Value), typed.Name, doubleQuoteEscape(typed.Separator), typed.Name)
+	case Remove:
+		return renderPosixRemove(typed)
+	case ChangeDir:
+		return fmt.Sprintf("cd %s", Quote(typed.Dir))
+	case Run:
+		if typed.Raw != "" {
+			// Grouped so operators in the command don't bind to the chain around it
+			return fmt.Sprintf("{ %s\n}", typed.Raw)
+		}
+		return quoteWords(typed.Args, Quote)
+	case DefineFunction:
+		return fmt.Sprintf("%s() {\n%s\n}", typed.Name, renderPosix(typed.Body))
+	case If:
+		rendered := fmt.Sprintf("if %s; then\n%s\n", renderPosixCondition(typed.Condition), renderPosix(typed.Then))
+		if !typed.Else.Empty() {
+			rendered += fmt.Sprintf("else\n%s\n", renderPosix(typed.Else))
+		}
+		return rendered + "fi"
+	case Trace:
+		if typed.On {
+			return "set -x"
+		}
+		return "set +x"
+	}
+	panic(fmt.Errorf("unknown shell action %T", action))
+}
+
+// Wraps the value in separators so the entry can be cut out with prefix and suffix removal, quoted parts of the patterns match literally
+func renderPosixRemove(remove Remove) string {
+	unsetEmpty := ""
+	if remove.UnsetEmpty {
+		unsetEmpty = fmt.Sprintf(`; [ -n "${%s}" ] || unset %s`, remove.Name, remove.Name)
+	}
+	separator := Quote(remove.Separator)
+	if remove.Separator == "" {
+		separator = "''"
+	}
+	entry := separator + Quote(remove.Value) + separator
+	return fmt.Sprintf(`case %s"${%s}"%s in *%s*) `, separator, remove.Name, separator, entry) +
+		fmt.Sprintf(`__remove_value=%s${%s}%s; `, separator, remove.Name, separator) +
+		fmt.Sprintf(`__remove_value=${__remove_value%%%%%s*}%s${__remove_value#*%s}; `, entry, separator, entry) +
+		fmt.Sprintf(`__remove_value=${__remove_value#%s}; `, separator) +
+		fmt.Sprintf(`%s=${__remove_value%%%s}; export %s; unset __remove_value%s;; esac`, remove.Name, separator, remove.Name, unsetEmpty)
+}
+
+func renderPosixCondition(condition Condition) string {
+	switch typed := condition.(type) {
+	case ShellIs:
+		switch typed.Name {
+		case Zsh:
+			return `[ -n "${ZSH_VERSION-}" ]`
+		case Bash:
+			return `[ -n "${BASH_VERSION-}" ]`
+		case Posix:
+			return "true"
+		}
+		return "false"
+	case VarSet:
+		return fmt.Sprintf(`[ -n "${%s+x}" ]`, typed.Name)
+	case Not:
+		return "! " + renderPosixCondition(typed.Condition)
+	}
+	panic(fmt.Errorf("unknown shell condition %T", condition))
+}
+
+func renderFish(script *Script) string {
+	if script.Empty() {
+		return "true"
+	}
+	// Every statement stops the sourced file or function on failure, chaining with and would bind to the keywords
+	// of multi line statements
+	lines := []string{}
+	for _, action := range script.Actions {
+		lines = append(lines, renderFishAction(action)+"; or return")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func renderFishAction(action Action) string {
+	switch typed := action.(type) {
+	case SetVar:
+		if isFishPathList(typed.Name) {
+			return fmt.Sprintf("set -gx %s (string split -- : %s)", typed.Name, FishQuote(typed.Value))
+		}
+		return fmt.Sprintf("set -gx %s %s", typed.Name, FishQuote(typed.Value))
+	case UnsetVar:
+		// set -e fails on unset variables which would break the chain
+		return fmt.Sprintf("if set -q %s; set -e %s; end", typed.Name, typed.Name)
+	case CopyVar:
+		return fmt.Sprintf("set -gx %s $%s", typed.To, typed.From)
+	case Prepend:
+		if isFishPathList(typed.Name) && typed.Separator == ":" {
+			return fmt.Sprintf("set -gx %s %s $%s", typed.Name, FishQuote(typed.Value), typed.Name)
+		}
+		return fmt.Sprintf(`if test -n "$%s"; set -gx %s %s%s"$%s"; else; set -gx %s %s; end`,
+			typed.Name, typed.Name, FishQuote(typed.Value), FishQuote(typed.Separator), typed.Name, typed.Name, FishQuote(typed.Value))
+	case Remove:
+		unsetEmpty := ""
+		if typed.UnsetEmpty {
+			unsetEmpty = fmt.Sprintf("; if test (count $%s) -eq 0; set -e %s; end", typed.Name, typed.Name)
+		}
+		if isFishPathList(typed.Name) && typed.Separator == ":" {
+			return fmt.Sprintf("if set -l index (contains -i -- %s $%s); set -e %s[$index]%s; end", FishQuote(typed.Value), typed.Name, typed.Name, unsetEmpty)
+		}
+		return fmt.Sprintf(`if set -q %s; set -l parts (string split -- %s "$%s"); if set -l index (contains -i -- %s $parts); set -e parts[$index]; set -gx %s (string join -- %s $parts)%s; end; end`,
+			typed.Name, FishQuote(typed.Separator), typed.Name, FishQuote(typed.Value), typed.Name, FishQuote(typed.Separator), unsetEmpty)
+	case ChangeDir:
+		return fmt.Sprintf("cd %s", FishQuote(typed.Dir))
+	case Run:
+		if typed.Raw != "" {
+			// Runs in a child sh, variables it sets don't reach fish
+			return fmt.Sprintf("sh -c %s", FishQuote(typed.Raw))
+		}
+		return quoteWords(typed.Args, FishQuote)
+	case DefineFunction:
+		return fmt.Sprintf("function %s\n%s\nend", typed.Name, renderFish(typed.Body))
+	case If:
+		rendered := fmt.Sprintf("if %s\n%s\n", renderFishCondition(typed.Condition), renderFish(typed.Then))
+		if !typed.Else.Empty() {
+			rendered += fmt.Sprintf("else\n%s\n", renderFish(typed.Else))
+		}
+		return rendered + "end"
+	case Trace:
+		if typed.On {
+			return "set -g fish_trace 1"
+		}
+		return "if set -q fish_trace; set -e fish_trace; end"
+	}
+	panic(fmt.Errorf("unknown shell action %T", action))
+}
+
+func renderFishCondition(condition Condition) string {
+	switch typed := condition.(type) {
+	case ShellIs:
+		if typed.Name == Fish {
+			return "true"
+		}
+		return "false"
+	case VarSet:
+		return fmt.Sprintf("set -q %s", typed.Name)
+	case Not:
+		return "not " + renderFishCondition(typed.Condition)
+	}
+	panic(fmt.Errorf("unknown shell condition %T", condition))
+}
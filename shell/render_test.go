@@ -0,0 +1,265 @@
+package shell
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The binary each shell is run with
+var testShells = []struct {
+	name   string
+	binary string
+}{{Posix, "sh"}, {Bash, "bash"}, {Zsh, "zsh"}, {Fish, "fish"}}
+
+// Values that break when quoted wrong in either shell
+var trickyValues = []string{
+	"plain",
+	"",
+	"two  spaces",
+	`double "quoted"`,
+	"it's",
+	"$HOME ${HOME} $(id)",
+	"`id`",
+	`back\slash \n \\`,
+	"line one\nline two\n",
+	"*",
+	"-n",
+	"trailing\\",
+	"semi; colon && and | pipe",
+	"ünïcode",
+}
+
+type shellRun struct {
+	output string
+	status int
+	env    map[string]string
+}
+
+// Sources the script rendered for the shell and dumps the environment after it, skips if the shell isn't installed
+func runRendered(t *testing.T, shellName string, binary string, script *Script) *shellRun {
+	t.Helper()
+	if _, err := exec.LookPath(binary); err != nil {
+		t.Skipf("%s not installed", binary)
+	}
+	dir, err := ioutil.TempDir("", "venvy-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scriptPath, envPath := filepath.Join(dir, "script"), filepath.Join(dir, "env")
+	if err := ioutil.WriteFile(scriptPath, []byte(Render(shellName, script)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source := "."
+	if shellName == Fish {
+		source = "source"
+	}
+	// The status is saved before env overwrites it, fish spells it $status
+	statusVar := "$?"
+	if shellName == Fish {
+		statusVar = "$status"
+	}
+	command := fmt.Sprintf("%s %s; echo %s > %s.status; env -0 > %s", source, Quote(scriptPath), statusVar, Quote(envPath), Quote(envPath))
+	cmd := exec.Command(binary, "-c", command)
+	cmd.Env = append(os.Environ(), "VENVY_TEST_LIST=/a:/b")
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s: %s %s", binary, err, output)
+	}
+	run := &shellRun{output: string(output), env: map[string]string{}}
+	statusData, err := ioutil.ReadFile(envPath + ".status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Sscan(string(statusData), &run.status)
+	envData, err := ioutil.ReadFile(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range strings.Split(strings.TrimSuffix(string(envData), "\x00"), "\x00") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 {
+			run.env[parts[0]] = parts[1]
+		}
+	}
+	return run
+}
+
+func TestRenderQuotingRoundTrips(t *testing.T) {
+	for _, testShell := range testShells {
+		t.Run(testShell.name, func(t *testing.T) {
+			script := New()
+			wantOutput := ""
+			for i, value := range trickyValues {
+				script.Set(fmt.Sprintf("VENVY_TEST_%d", i), value).Run("printf", "<%s>", value)
+				wantOutput += "<" + value + ">"
+			}
+			run := runRendered(t, testShell.name, testShell.binary, script)
+			if run.status != 0 {
+				t.Fatalf("script exited with %d", run.status)
+			}
+			if run.output != wantOutput {
+				t.Errorf("args printed as\n%q\nexpected\n%q", run.output, wantOutput)
+			}
+			for i, value := range trickyValues {
+				if got := run.env[fmt.Sprintf("VENVY_TEST_%d", i)]; got != value {
+					t.Errorf("VENVY_TEST_%d is %q, expected %q", i, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderListVariables(t *testing.T) {
+	tricky := "/opt/it's a $dir"
+	cases := []struct {
+		name   string
+		script *Script
+		want   map[string]string
+		unset  []string
+	}{
+		{
+			name:   "prepend",
+			script: New().PrependPath("VENVY_TEST_LIST", tricky),
+			want:   map[string]string{"VENVY_TEST_LIST": tricky + ":/a:/b"},
+		},
+		{
+			name:   "prepend to unset",
+			script: New().PrependPath("VENVY_TEST_NEW", tricky),
+			want:   map[string]string{"VENVY_TEST_NEW": tricky},
+		},
+		{
+			name:   "remove",
+			script: New().Add(Remove{Name: "VENVY_TEST_LIST", Value: "/a", Separator: ":"}),
+			want:   map[string]string{"VENVY_TEST_LIST": "/b"},
+		},
+		{
+			name:   "remove missing entry",
+			script: New().Add(Remove{Name: "VENVY_TEST_LIST", Value: "/c", Separator: ":"}),
+			want:   map[string]string{"VENVY_TEST_LIST": "/a:/b"},
+		},
+		{
+			name: "prepend and remove path",
+			script: New().PrependPath("PATH", tricky).PrependPath("VENVY_TEST_LIST", tricky).
+				Add(Remove{Name: "PATH", Value: tricky, Separator: ":"}, Remove{Name: "VENVY_TEST_LIST", Value: tricky, Separator: ":"}),
+			want: map[string]string{"PATH": os.Getenv("PATH"), "VENVY_TEST_LIST": "/a:/b"},
+		},
+		{
+			name:   "unset and copy",
+			script: New().Copy("VENVY_TEST_LIST", "VENVY_TEST_COPY").Unset("VENVY_TEST_LIST", "VENVY_TEST_NEVER_SET"),
+			want:   map[string]string{"VENVY_TEST_COPY": "/a:/b"},
+			unset:  []string{"VENVY_TEST_LIST", "VENVY_TEST_NEVER_SET"},
+		},
+	}
+	for _, testShell := range testShells {
+		for _, tc := range cases {
+			t.Run(testShell.name+"/"+tc.name, func(t *testing.T) {
+				run := runRendered(t, testShell.name, testShell.binary, tc.script)
+				if run.status != 0 {
+					t.Fatalf("script exited with %d", run.status)
+				}
+				for name, want := range tc.want {
+					if got, ok := run.env[name]; !ok || got != want {
+						t.Errorf("%s is %q, expected %q", name, got, want)
+					}
+				}
+				for _, name := range tc.unset {
+					if got, ok := run.env[name]; ok {
+						t.Errorf("%s is %q, expected it unset", name, got)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRenderStopsAtFailure(t *testing.T) {
+	cases := []struct {
+		name    string
+		script  *Script
+		set     []string
+		notSet  []string
+		failing bool
+	}{
+		{
+			name:    "failing command",
+			script:  New().Set("VENVY_TEST_A", "1").Run("false").Set("VENVY_TEST_B", "1"),
+			set:     []string{"VENVY_TEST_A"},
+			notSet:  []string{"VENVY_TEST_B"},
+			failing: true,
+		},
+		{
+			name: "if without a branch taken",
+			script: New().If(VarSet{Name: "VENVY_TEST_NEVER_SET"}, New().Set("VENVY_TEST_A", "1"), nil).
+				Unset("VENVY_TEST_NEVER_SET").Set("VENVY_TEST_B", "1"),
+			set:    []string{"VENVY_TEST_B"},
+			notSet: []string{"VENVY_TEST_A"},
+		},
+		{
+			name:    "failing branch",
+			script:  New().If(Not{VarSet{Name: "VENVY_TEST_NEVER_SET"}}, New().Run("false"), nil).Set("VENVY_TEST_B", "1"),
+			notSet:  []string{"VENVY_TEST_B"},
+			failing: true,
+		},
+		{
+			name:    "command word looking like an assignment",
+			script:  New().Run("VENVY_TEST_A=1", "true").Set("VENVY_TEST_B", "1"),
+			notSet:  []string{"VENVY_TEST_A", "VENVY_TEST_B"},
+			failing: true,
+		},
+		{
+			name: "failing function",
+			script: New().Function("venvy_test_fn", New().Set("VENVY_TEST_A", "1").Run("false").Set("VENVY_TEST_B", "1")).
+				Run("venvy_test_fn").Set("VENVY_TEST_C", "1"),
+			set:     []string{"VENVY_TEST_A"},
+			notSet:  []string{"VENVY_TEST_B", "VENVY_TEST_C"},
+			failing: true,
+		},
+	}
+	for _, testShell := range testShells {
+		for _, tc := range cases {
+			t.Run(testShell.name+"/"+tc.name, func(t *testing.T) {
+				run := runRendered(t, testShell.name, testShell.binary, tc.script)
+				if (run.status != 0) != tc.failing {
+					t.Errorf("script exited with %d", run.status)
+				}
+				for _, name := range tc.set {
+					if _, ok := run.env[name]; !ok {
+						t.Errorf("%s is not set", name)
+					}
+				}
+				for _, name := range tc.notSet {
+					if _, ok := run.env[name]; ok {
+						t.Errorf("%s is set", name)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Checked as text too as fish is rarely installed where the tests run
+func TestRenderFishStatements(t *testing.T) {
+	script := New().
+		Set("A", "it's").
+		If(VarSet{Name: "B"}, New().Unset("B"), nil).
+		Function("f", New().Run("false").Set("C", "1")).
+		RunRaw("export D=1")
+	want := `set -gx A 'it\'s'; or return
+if set -q B
+if set -q B; set -e B; end; or return
+end; or return
+function f
+false; or return
+set -gx C 1; or return
+end; or return
+sh -c 'export D=1'; or return`
+	if got := Render(Fish, script); got != want {
+		t.Errorf("rendered\n%s\nexpected\n%s", got, want)
+	}
+}
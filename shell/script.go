@@ -0,0 +1,237 @@
+package shell
+
+// Shells a script can be rendered for, bash and zsh share the posix renderer
+const Posix = "sh"
+const Bash = "bash"
+const Zsh = "zsh"
+const Fish = "fish"
+
+// A single step of a script, rendered per shell with values quoted so they round-trip exactly
+type Action interface {
+	action()
+}
+
+// Export a variable with a literal value
+type SetVar struct {
+	Name  string
+	Value string
+}
+
+type UnsetVar struct {
+	Name string
+}
+
+// Export the value of one variable under another name
+type CopyVar struct {
+	From string
+	To   string
+}
+
+// Prefix a separated list variable such as PATH, the separator is skipped when the variable is empty
+type Prepend struct {
+	Name      string
+	Value     string
+	Separator string
+}
+
+// Drop the first entry equal to Value from a separated list variable, undoing a Prepend without touching other entries
+type Remove struct {
+	Name      string
+	Value     string
+	Separator string
+	// Unset the variable when the entry was the last one, for variables the Prepend created
+	UnsetEmpty bool
+}
+
+type ChangeDir struct {
+	Dir string
+}
+
+// Run a command, Args are quoted as words. Raw is a posix command line used as is, fish runs it through sh so it
+// can't change the fish environment.
+type Run struct {
+	Args []string
+	Raw  string
+}
+
+type DefineFunction struct {
+	Name string
+	Body *Script
+}
+
+type If struct {
+	Condition Condition
+	Then      *Script
+	Else      *Script
+}
+
+// Turn command tracing on or off
+type Trace struct {
+	On bool
+}
+
+func (SetVar) action()         {}
+func (UnsetVar) action()       {}
+func (CopyVar) action()        {}
+func (Prepend) action()        {}
+func (Remove) action()         {}
+func (ChangeDir) action()      {}
+func (Run) action()            {}
+func (DefineFunction) action() {}
+func (If) action()             {}
+func (Trace) action()          {}
+
+type Condition interface {
+	condition()
+}
+
+// True when the script is rendered for or run by the named shell
+type ShellIs struct {
+	Name string
+}
+
+// True when the variable is set, even if empty
+type VarSet struct {
+	Name string
+}
+
+type Not struct {
+	Condition Condition
+}
+
+func (ShellIs) condition() {}
+func (VarSet) condition()  {}
+func (Not) condition()     {}
+
+// An ordered list of actions, the builder methods return the script so calls can be chained
+type Script struct {
+	Actions []Action
+}
+
+func New() *Script {
+	return &Script{}
+}
+
+func (s *Script) Add(actions ...Action) *Script {
+	s.Actions = append(s.Actions, actions...)
+	return s
+}
+
+// Appends the actions of other scripts, nil scripts are skipped
+func (s *Script) Extend(others ...*Script) *Script {
+	for _, other := range others {
+		if other != nil {
+			s.Actions = append(s.Actions, other.Actions...)
+		}
+	}
+	return s
+}
+
+func (s *Script) Empty() bool {
+	return s == nil || len(s.Actions) == 0
+}
+
+func (s *Script) Set(name string, value string) *Script {
+	return s.Add(SetVar{Name: name, Value: value})
+}
+
+func (s *Script) Unset(names ...string) *Script {
+	for _, name := range names {
+		s.Add(UnsetVar{Name: name})
+	}
+	return s
+}
+
+func (s *Script) Copy(from string, to string) *Script {
+	return s.Add(CopyVar{From: from, To: to})
+}
+
+func (s *Script) PrependPath(name string, dir string) *Script {
+	return s.Add(Prepend{Name: name, Value: dir, Separator: ":"})
+}
+
+func (s *Script) Cd(dir string) *Script {
+	return s.Add(ChangeDir{Dir: dir})
+}
+
+func (s *Script) Run(args ...string) *Script {
+	return s.Add(Run{Args: args})
+}
+
+func (s *Script) RunRaw(command string) *Script {
+	return s.Add(Run{Raw: command})
+}
+
+func (s *Script) Function(name string, body *Script) *Script {
+	return s.Add(DefineFunction{Name: name, Body: body})
+}
+
+func (s *Script) If(condition Condition, then *Script, otherwise *Script) *Script {
+	return s.Add(If{Condition: condition, Then: then, Else: otherwise})
+}
+
+// Variables the script assigns or unsets, in order. Conditional branches count, function bodies don't as they run later.
+func (s *Script) Changes() (assigned []string) {
+	if s.Empty() {
+		return nil
+	}
+	seen := map[string]bool{}
+	assign := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			assigned = append(assigned, name)
+		}
+	}
+	for _, action := range s.Actions {
+		switch typed := action.(type) {
+		case SetVar:
+			assign(typed.Name)
+		case UnsetVar:
+			assign(typed.Name)
+		case CopyVar:
+			assign(typed.To)
+		case If:
+			for _, branch := range []*Script{typed.Then, typed.Else} {
+				for _, name := range branch.Changes() {
+					assign(name)
+				}
+			}
+		}
+	}
+	return assigned
+}
+
+// Reverts the changes of the script: prepended entries are removed in place, other variables get the value lookup reports.
+// Passing os.LookupEnv before the script runs snapshots the environment it changes.
+func (s *Script) Undo(lookup func(name string) (string, bool)) *Script {
+	undo := s.undoPrepends(lookup)
+	for _, name := range s.Changes() {
+		if value, ok := lookup(name); ok {
+			undo.Set(name, value)
+		} else {
+			undo.Unset(name)
+		}
+	}
+	return undo
+}
+
+// Removes for the script's prepends, last first. A prepend made in a branch is removed under the same condition so only the branch that ran is undone.
+func (s *Script) undoPrepends(lookup func(name string) (string, bool)) *Script {
+	undo := New()
+	if s.Empty() {
+		return undo
+	}
+	for i := len(s.Actions) - 1; i >= 0; i-- {
+		switch typed := s.Actions[i].(type) {
+		case Prepend:
+			_, wasSet := lookup(typed.Name)
+			undo.Add(Remove{Name: typed.Name, Value: typed.Value, Separator: typed.Separator, UnsetEmpty: !wasSet})
+		case If:
+			then, otherwise := typed.Then.undoPrepends(lookup), typed.Else.undoPrepends(lookup)
+			if !then.Empty() || !otherwise.Empty() {
+				undo.If(typed.Condition, then, otherwise)
+			}
+		}
+	}
+	return undo
+}
@@ -0,0 +1,109 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		value, ok := map[string]string{"A": "before", "EMPTY": "", "PATH": "/bin"}[name]
+		return value, ok
+	}
+	cases := []struct {
+		name   string
+		script *Script
+		want   []Action
+	}{
+		{
+			name:   "nothing changed",
+			script: New().Run("true").Cd("/tmp").Function("f", New().Set("A", "1")),
+		},
+		{
+			name:   "set vars get their snapshot value",
+			script: New().Set("A", "1").Set("EMPTY", "1").Set("NEW", "1"),
+			want:   []Action{SetVar{Name: "A", Value: "before"}, SetVar{Name: "EMPTY", Value: ""}, UnsetVar{Name: "NEW"}},
+		},
+		{
+			name:   "unset and copied vars",
+			script: New().Unset("A").Copy("PATH", "NEW"),
+			want:   []Action{SetVar{Name: "A", Value: "before"}, UnsetVar{Name: "NEW"}},
+		},
+		{
+			name:   "changed twice restored once",
+			script: New().Set("A", "1").Unset("A").Set("A", "2"),
+			want:   []Action{SetVar{Name: "A", Value: "before"}},
+		},
+		{
+			name:   "prepends removed last first",
+			script: New().PrependPath("PATH", "/one").Set("A", "1").PrependPath("PATH", "/two"),
+			want: []Action{
+				Remove{Name: "PATH", Value: "/two", Separator: ":"},
+				Remove{Name: "PATH", Value: "/one", Separator: ":"},
+				SetVar{Name: "A", Value: "before"},
+			},
+		},
+		{
+			name:   "prepends to unset vars unset them when emptied",
+			script: New().Add(Prepend{Name: "NEW", Value: "/one", Separator: ":"}),
+			want:   []Action{Remove{Name: "NEW", Value: "/one", Separator: ":", UnsetEmpty: true}},
+		},
+		{
+			name:   "both branches of an if",
+			script: New().If(VarSet{Name: "X"}, New().Set("NEW", "1"), New().PrependPath("PATH", "/else")),
+			want: []Action{
+				If{Condition: VarSet{Name: "X"}, Then: New(), Else: New().Add(Remove{Name: "PATH", Value: "/else", Separator: ":"})},
+				UnsetVar{Name: "NEW"},
+			},
+		},
+		{
+			name: "prepends in branches removed under the same condition",
+			script: New().If(ShellIs{Name: Zsh}, New().Add(Prepend{Name: "PS1", Value: "(env)", Separator: " "}),
+				New().Add(Prepend{Name: "PS1", Value: "(env)", Separator: " "})),
+			want: []Action{If{
+				Condition: ShellIs{Name: Zsh},
+				Then:      New().Add(Remove{Name: "PS1", Value: "(env)", Separator: " ", UnsetEmpty: true}),
+				Else:      New().Add(Remove{Name: "PS1", Value: "(env)", Separator: " ", UnsetEmpty: true}),
+			}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.script.Undo(lookup).Actions
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("undo is %#v, expected %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+// Running a script and then its undo leaves the environment as it was, in every shell
+func TestUndoRestoresEnvironment(t *testing.T) {
+	values := map[string]string{"VENVY_TEST_LIST": "/a:/b", "PATH": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+	tricky := "/opt/it's a $dir"
+	script := New().
+		Set("VENVY_TEST_LIST", tricky).
+		Set("VENVY_TEST_NEW", tricky).
+		PrependPath("PATH", tricky).
+		Add(Prepend{Name: "VENVY_TEST_PREPENDED", Value: "x", Separator: ":"})
+	for _, testShell := range testShells {
+		t.Run(testShell.name, func(t *testing.T) {
+			before := runRendered(t, testShell.name, testShell.binary, New())
+			values["PATH"] = before.env["PATH"]
+			run := runRendered(t, testShell.name, testShell.binary, New().Extend(script, script.Undo(lookup)))
+			if run.status != 0 {
+				t.Fatalf("script exited with %d", run.status)
+			}
+			for _, name := range []string{"VENVY_TEST_LIST", "VENVY_TEST_NEW", "PATH", "VENVY_TEST_PREPENDED"} {
+				want, wantOk := before.env[name]
+				if got, ok := run.env[name]; got != want || ok != wantOk {
+					t.Errorf("%s is %q (set %v), expected %q (set %v)", name, got, ok, want, wantOk)
+				}
+			}
+		})
+	}
+}
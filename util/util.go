@@ -7,11 +7,16 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/mitchellh/go-homedir"
 	"gopkg.in/go-playground/validator.v9"
-	"html/template"
+	"gopkg.in/yaml.v2"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"text/template"
 )
 
 func PathExists(path string) bool {
@@ -34,6 +39,112 @@ func UnmarshalAndValidate(data []byte, v interface{}) error {
 	return ValidateStruct(v)
 }
 
+var unknownFieldRe = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// Like UnmarshalAndValidate but unknown keys are an error, suggesting the closest known key
+func UnmarshalStrict(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return ValidateStruct(v)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		match := unknownFieldRe.FindStringSubmatch(err.Error())
+		if match == nil {
+			return err
+		}
+		known := JsonKeys(reflect.TypeOf(v))
+		if suggestion := ClosestString(match[1], known); suggestion != "" {
+			return fmt.Errorf("unknown config key %q, did you mean %q?", match[1], suggestion)
+		}
+		if len(known) == 0 {
+			return fmt.Errorf("unknown config key %q, no keys are supported", match[1])
+		}
+		return fmt.Errorf("unknown config key %q, expected one of %s", match[1], strings.Join(known, ", "))
+	}
+	return ValidateStruct(v)
+}
+
+// Keys a json decode into t accepts, including those of nested structs
+func JsonKeys(t reflect.Type) []string {
+	keys := []string{}
+	seen := map[reflect.Type]bool{}
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous {
+				collect(field.Type)
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			keys = append(keys, name)
+			collect(field.Type)
+		}
+	}
+	collect(t)
+	sort.Strings(keys)
+	return keys
+}
+
+// The candidate within a couple of edits of value, ignoring case, or "" when none is close
+func ClosestString(value string, candidates []string) string {
+	best := ""
+	bestDistance := len(value)/3 + 2
+	for _, candidate := range candidates {
+		distance := levenshtein(strings.ToLower(value), strings.ToLower(candidate))
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func min(values ...int) int {
+	smallest := values[0]
+	for _, value := range values[1:] {
+		if value < smallest {
+			smallest = value
+		}
+	}
+	return smallest
+}
+
 func StringTemplate(tmplName, tmpl string, data interface{}) (string, error) {
 	parsedTemplate, err := template.New(tmplName).Parse(tmpl)
 	if err != nil {
@@ -57,6 +168,83 @@ func TomlToJson(data []byte) ([]byte, error) {
 	return json.Marshal(&target)
 }
 
+// yaml decodes maps with interface keys which json can't encode
+func stringKeys(value interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, item := range typed {
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported non string key %v", key)
+			}
+			convertedItem, err := stringKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			converted[keyStr] = convertedItem
+		}
+		return converted, nil
+	case []interface{}:
+		for i, item := range typed {
+			convertedItem, err := stringKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			typed[i] = convertedItem
+		}
+	}
+	return value, nil
+}
+
+// Same as TomlToJson for yaml sources
+func YamlToJson(data []byte) ([]byte, error) {
+	var target interface{}
+	err := yaml.Unmarshal(data, &target)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := stringKeys(target)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&converted)
+}
+
+// Converts a config file to json based on its extension, toml unless it's yaml or json
+func ConfigToJson(filePath string, data []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml":
+		return YamlToJson(data)
+	case ".json":
+		if !json.Valid(data) {
+			var target interface{}
+			return nil, json.Unmarshal(data, &target)
+		}
+		return data, nil
+	default:
+		return TomlToJson(data)
+	}
+}
+
+// 1 based line number of a byte offset in data
+func LineOfOffset(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// 1 based line number of the first line matching re, 0 when none does
+func FindLine(data []byte, re *regexp.Regexp) int {
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if re.Match(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
 func FindPathInAncestors(start string, pathToFind string) (string, error) {
 	if start == "" {
 		var err error
@@ -74,6 +262,15 @@ func FindPathInAncestors(start string, pathToFind string) (string, error) {
 	return FindPathInAncestors(path.Dir(start), pathToFind)
 }
 
+// Whether child is parent or lives under it
+func PathContains(parent string, child string) bool {
+	rel, err := filepath.Rel(parent, child)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../"))
+}
+
 func MustExpandPath(path string) string {
 	expanded, err := homedir.Expand(path)
 	if err != nil {
@@ -0,0 +1,192 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStringTemplateDoesNotEscape(t *testing.T) {
+	value := `'$HOME' "a" <b> c&&d`
+	got, err := StringTemplate("test", `echo {{ .Value }} 2>&1 <in`, struct{ Value string }{Value: value})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "echo " + value + " 2>&1 <in"; got != want {
+		t.Errorf("rendered %q, expected %q", got, want)
+	}
+}
+
+func TestConfigToJson(t *testing.T) {
+	want := map[string]interface{}{
+		"namespace": "acme",
+		"modules":   []interface{}{map[string]interface{}{"name": "py", "type": "python", "config": map[string]interface{}{"version": "3.8", "nested": map[string]interface{}{"enabled": true}}}},
+		"projects":  []interface{}{map[string]interface{}{"name": "app", "modules": []interface{}{"py"}}},
+	}
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "toml",
+			file:    "venvy.toml",
+			content: "namespace = \"acme\"\n\n[[modules]]\nname = \"py\"\ntype = \"python\"\n\t[modules.config]\n\tversion = \"3.8\"\n\t[modules.config.nested]\n\tenabled = true\n\n[[projects]]\nname = \"app\"\nmodules = [\"py\"]\n",
+		},
+		{
+			name:    "yaml",
+			file:    "venvy.yaml",
+			content: "namespace: acme\nmodules:\n  - name: py\n    type: python\n    config:\n      version: \"3.8\"\n      nested:\n        enabled: true\nprojects:\n  - name: app\n    modules: [py]\n",
+		},
+		{
+			name:    "yml in upper case",
+			file:    "VENVY.YML",
+			content: "namespace: acme\nmodules: [{name: py, type: python, config: {version: \"3.8\", nested: {enabled: true}}}]\nprojects: [{name: app, modules: [py]}]\n",
+		},
+		{
+			name:    "json",
+			file:    "venvy.json",
+			content: `{"namespace": "acme", "modules": [{"name": "py", "type": "python", "config": {"version": "3.8", "nested": {"enabled": true}}}], "projects": [{"name": "app", "modules": ["py"]}]}`,
+		},
+		{
+			name:    "yaml non string key",
+			file:    "venvy.yaml",
+			content: "modules:\n  - name: py\n    config:\n      1: one\n",
+			wantErr: "unsupported non string key 1",
+		},
+		{
+			name:    "yaml syntax",
+			file:    "venvy.yaml",
+			content: "modules:\n  - name: py\n   type: python\n",
+			wantErr: "yaml: line 2",
+		},
+		{
+			name:    "json syntax",
+			file:    "venvy.json",
+			content: "{\"modules\": [}",
+			wantErr: "invalid character '}'",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			jsonData, err := ConfigToJson(tc.file, []byte(tc.content))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, expected %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got interface{}
+			if err := json.Unmarshal(jsonData, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded as %v, expected %v", got, want)
+			}
+		})
+	}
+}
+
+type strictTestPackage struct {
+	Name    string `json:"name"`
+	Extras  []string
+	ignored string
+}
+
+type strictTestOrdering struct {
+	After []string `json:"after"`
+}
+
+type strictTestConfig struct {
+	strictTestOrdering
+	Version  string               `json:"version" validate:"required"`
+	Packages []*strictTestPackage `json:"packages"`
+	Source   string               `json:"-"`
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		target  interface{}
+		wantErr string
+	}{
+		{
+			name:   "known keys",
+			data:   `{"version": "3", "after": ["py"], "packages": [{"name": "x", "Extras": ["y"]}]}`,
+			target: &strictTestConfig{},
+		},
+		{
+			name:    "typo",
+			data:    `{"versoin": "3"}`,
+			target:  &strictTestConfig{},
+			wantErr: `unknown config key "versoin", did you mean "version"?`,
+		},
+		{
+			name:    "case",
+			data:    `{"Version": "3", "PACKAGE": []}`,
+			target:  &strictTestConfig{},
+			wantErr: `unknown config key "PACKAGE", did you mean "packages"?`,
+		},
+		{
+			name:    "nested typo",
+			data:    `{"version": "3", "packages": [{"nmae": "x"}]}`,
+			target:  &strictTestConfig{},
+			wantErr: `unknown config key "nmae", did you mean "name"?`,
+		},
+		{
+			name:    "embedded typo",
+			data:    `{"version": "3", "afterr": []}`,
+			target:  &strictTestConfig{},
+			wantErr: `unknown config key "afterr", did you mean "after"?`,
+		},
+		{
+			name:    "nothing close",
+			data:    `{"version": "3", "interpreter": "py"}`,
+			target:  &strictTestConfig{},
+			wantErr: `unknown config key "interpreter", expected one of Extras, after, name, packages, version`,
+		},
+		{
+			name:    "skipped fields aren't keys",
+			data:    `{"version": "3", "Source": "x"}`,
+			target:  &strictTestConfig{},
+			wantErr: `unknown config key "Source", expected one of Extras, after, name, packages, version`,
+		},
+		{
+			name:    "no keys",
+			data:    `{"version": "3"}`,
+			target:  &struct{}{},
+			wantErr: `unknown config key "version", no keys are supported`,
+		},
+		{
+			name:    "still validated",
+			data:    `{"after": []}`,
+			target:  &strictTestConfig{},
+			wantErr: "'Version' failed on the 'required' tag",
+		},
+		{
+			name:    "empty is validated",
+			target:  &strictTestConfig{},
+			wantErr: "'Version' failed on the 'required' tag",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := UnmarshalStrict([]byte(tc.data), tc.target)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected %q", err, tc.wantErr)
+			}
+		})
+	}
+}